@@ -23,11 +23,11 @@ func main() {
 		url = "localhost:8092"
 	}
 
-	fmt.Printf("Starting %d workers with delay %d ms, orchestrator url is %s\n", computingPower, delayMs, url)
+	info := agent.NewAgentInfo(computingPower)
+	fmt.Printf("Starting agent %s with %d workers with delay %d ms, orchestrator url is %s\n", info.AgentId, computingPower, delayMs, url)
 
-	for i := 0; i < computingPower; i++ {
-		go agent.Worker(delayMs, url)
-	}
+	go agent.Heartbeat(info, url)
+	go agent.StreamWorker(delayMs, url, info.AgentId, computingPower)
 
 	select {}
 }
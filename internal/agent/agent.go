@@ -3,19 +3,145 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	pb "github.com/denis-gr/GOCACL_DISTRIBUTED/internal/gen"
+	"github.com/denis-gr/GOCACL_DISTRIBUTED/pkg/calc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+
+	"github.com/google/uuid"
 )
 
-// Worker используется для обозначения ошибки, когда элемент не найден.
-func Worker(delayMs int64, grpcAddress string) {
+// Version — версия агента, сообщается оркестратору при регистрации.
+// Может быть задана при сборке: -ldflags "-X .../internal/agent.Version=1.2.0".
+var Version = "dev"
+
+// agentIDMetadata — ключ метаданных gRPC, в котором агент передает свой идентификатор.
+const agentIDMetadata = "x-agent-id"
+
+// errDivisionByZero сообщается оркестратору при делении на ноль.
+var errDivisionByZero = &taskError{calc.ErrCodeDivisionByZero, calc.ErrDivisionByZero.Error()}
+
+// NewAgentInfo описывает агента, выполняющего capacity задач одновременно.
+// Идентификатор берется из переменной окружения AGENT_ID, а если она не задана,
+// создается новый при каждом запуске. Метки агента перечисляются в переменной
+// окружения AGENT_LABELS через запятую, например, "precision=big,zone=a".
+func NewAgentInfo(capacity int) *pb.AgentInfo {
+	id := os.Getenv("AGENT_ID")
+	if id == "" {
+		uid, _ := uuid.NewV7()
+		id = uid.String()
+	}
+	hostname, _ := os.Hostname()
+	return &pb.AgentInfo{
+		AgentId:    id,
+		Hostname:   hostname,
+		Version:    Version,
+		Capacity:   int32(capacity),
+		Operations: Operations(),
+		Functions:  functionInfos(),
+		Labels:     parseLabels(os.Getenv("AGENT_LABELS")),
+	}
+}
+
+// parseLabels разбирает метки вида "ключ=значение", перечисленные через запятую.
+// Метки без имени пропускаются.
+// Пример: "precision=big, zone=a" -> {"precision": "big", "zone": "a"}
+func parseLabels(s string) map[string]string {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			log.Printf("Skipping agent label without a name: %q", pair)
+			continue
+		}
+		labels[key] = strings.TrimSpace(value)
+	}
+	return labels
+}
+
+// Heartbeat регистрирует агента в оркестраторе и затем сообщает, что агент жив,
+// с интервалом, который задает оркестратор. Если оркестратор недоступен,
+// попытки повторяются.
+func Heartbeat(info *pb.AgentInfo, grpcAddress string) {
+	conn, err := grpc.NewClient(grpcAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("Failed to connect to gRPC server: %v", err)
+	}
+	defer conn.Close()
+
+	client := pb.NewOrchestratorServiceClient(conn)
+
+	interval, err := registerAgent(client, info)
+	for err != nil {
+		log.Println("Error registering agent:", err)
+		time.Sleep(interval)
+		interval, err = registerAgent(client, info)
+	}
+	log.Printf("Agent %s registered", info.AgentId)
+	for {
+		time.Sleep(interval)
+		interval, err = sendHeartbeat(client, info)
+		if err != nil {
+			log.Println("Error sending heartbeat:", err)
+		}
+	}
+}
+
+// defaultHeartbeatInterval используется, пока оркестратор не сообщил свой интервал.
+const defaultHeartbeatInterval = 2 * time.Second
+
+// registerAgent регистрирует агента и возвращает интервал сигналов.
+func registerAgent(client pb.OrchestratorServiceClient, info *pb.AgentInfo) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	response, err := client.RegisterAgent(ctx, info)
+	if err != nil {
+		return defaultHeartbeatInterval, err
+	}
+	return heartbeatInterval(response), nil
+}
+
+// sendHeartbeat сообщает, что агент жив, и возвращает интервал сигналов.
+func sendHeartbeat(client pb.OrchestratorServiceClient, info *pb.AgentInfo) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	response, err := client.Heartbeat(ctx, info)
+	if err != nil {
+		return defaultHeartbeatInterval, err
+	}
+	return heartbeatInterval(response), nil
+}
+
+// heartbeatInterval возвращает интервал сигналов из ответа оркестратора.
+func heartbeatInterval(response *pb.AgentResponse) time.Duration {
+	if response.HeartbeatIntervalMs <= 0 {
+		return defaultHeartbeatInterval
+	}
+	return time.Duration(response.HeartbeatIntervalMs) * time.Millisecond
+}
+
+// Worker получает задачи от оркестратора от имени агента agentID, выполняет их
+// и отправляет результаты.
+func Worker(delayMs int64, grpcAddress string, agentID string) {
 	conn, err := grpc.NewClient(grpcAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		log.Fatalf("Failed to connect to gRPC server: %v", err)
@@ -26,7 +152,7 @@ func Worker(delayMs int64, grpcAddress string) {
 
 	for {
 		nextRun := time.Now().Add(time.Duration(delayMs) * time.Millisecond)
-		task := getTask(client)
+		task := getTask(client, agentID)
 		if task != nil {
 			result := performTask(task)
 			err := sendResult(client, result)
@@ -38,9 +164,215 @@ func Worker(delayMs int64, grpcAddress string) {
 	}
 }
 
-func getTask(client pb.OrchestratorServiceClient) *pb.Task {
+// BatchWorker опрашивает оркестратор раз в delayMs и за один запрос получает
+// столько задач, сколько у агента свободных мест из capacity. Результаты задач,
+// выполненных между опросами, отправляются вместе. Если оркестратор не
+// поддерживает пакетные запросы, запускаются capacity экземпляров Worker.
+func BatchWorker(delayMs int64, grpcAddress string, agentID string, capacity int) {
+	conn, err := grpc.NewClient(grpcAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("Failed to connect to gRPC server: %v", err)
+	}
+	defer conn.Close()
+
+	client := pb.NewOrchestratorServiceClient(conn)
+
+	b := newBatcher(client, agentID, capacity)
+	for {
+		nextRun := time.Now().Add(time.Duration(delayMs) * time.Millisecond)
+		err := b.poll()
+		if status.Code(err) == codes.Unimplemented && b.busy == 0 {
+			log.Println("Orchestrator does not support batch requests, falling back to single tasks")
+			for i := 0; i < capacity; i++ {
+				go Worker(delayMs, grpcAddress, agentID)
+			}
+			return
+		}
+		if err != nil {
+			log.Println("Error polling tasks:", err)
+		}
+		time.Sleep(time.Until(nextRun))
+	}
+}
+
+// batcher получает задачи и отправляет результаты пакетами.
+type batcher struct {
+	client   pb.OrchestratorServiceClient
+	agentID  string
+	capacity int
+	busy     int                        // Число выполняемых задач, результаты которых еще не отправлены
+	results  chan *pb.TaskResultRequest // Результаты выполненных задач, буфер рассчитан на capacity
+	pending  []*pb.TaskResultRequest    // Результаты, которые не удалось отправить
+}
+
+func newBatcher(client pb.OrchestratorServiceClient, agentID string, capacity int) *batcher {
+	return &batcher{
+		client:   client,
+		agentID:  agentID,
+		capacity: capacity,
+		results:  make(chan *pb.TaskResultRequest, capacity),
+	}
+}
+
+// poll отправляет накопленные результаты и запрашивает задачи на свободные места.
+// Если результаты не удалось отправить, новые задачи не запрашиваются, а отправка
+// повторяется при следующем опросе.
+func (b *batcher) poll() error {
+	for collecting := true; collecting; {
+		select {
+		case result := <-b.results:
+			b.pending = append(b.pending, result)
+		default:
+			collecting = false
+		}
+	}
+	if len(b.pending) > 0 {
+		if err := sendResults(b.client, b.pending); err != nil {
+			return err
+		}
+		b.busy -= len(b.pending)
+		b.pending = nil
+	}
+
+	free := b.capacity - b.busy
+	if free <= 0 {
+		return nil
+	}
+	tasks, err := getTasks(b.client, b.agentID, free)
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		b.busy++
+		go func() {
+			b.results <- performTask(task)
+		}()
+	}
+	return nil
+}
+
+// StreamWorker получает задачи от оркестратора в потоке и выполняет до capacity
+// задач одновременно. При разрыве потока подключается снова через delayMs.
+// Если оркестратор не поддерживает потоковую выдачу задач, агент опрашивает его
+// с помощью BatchWorker.
+func StreamWorker(delayMs int64, grpcAddress string, agentID string, capacity int) {
+	conn, err := grpc.NewClient(grpcAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("Failed to connect to gRPC server: %v", err)
+	}
+	defer conn.Close()
+
+	client := pb.NewOrchestratorServiceClient(conn)
+
+	slots := &streamSlots{capacity: capacity}
+	for {
+		err := streamTasks(client, agentID, slots)
+		if status.Code(err) == codes.Unimplemented {
+			log.Println("Orchestrator does not support task streaming, falling back to polling")
+			BatchWorker(delayMs, grpcAddress, agentID, capacity)
+			return
+		}
+		log.Println("Task stream closed:", err)
+		time.Sleep(time.Duration(delayMs) * time.Millisecond)
+	}
+}
+
+// streamSlots учитывает места агента во всех потоках задач. Задача, полученная
+// из разорванного потока, после выполнения освобождает место в текущем потоке,
+// поэтому переподключения не уменьшают число мест, объявленных оркестратору.
+type streamSlots struct {
+	mu       sync.Mutex
+	capacity int
+	busy     int                                      // Число выполняемых задач
+	stream   pb.OrchestratorService_StreamTasksClient // Текущий поток, nil между подключениями
+}
+
+// open делает поток текущим и объявляет в нем свободные места.
+func (s *streamSlots) open(stream pb.OrchestratorService_StreamTasksClient) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stream = stream
+	if free := s.capacity - s.busy; free > 0 {
+		return stream.Send(&pb.AgentMessage{FreeSlots: int32(free)})
+	}
+	return nil
+}
+
+// close забывает поток, если он еще текущий.
+func (s *streamSlots) close(stream pb.OrchestratorService_StreamTasksClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stream == stream {
+		s.stream = nil
+	}
+}
+
+// take занимает место под полученную задачу.
+func (s *streamSlots) take() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.busy++
+}
+
+// finish освобождает место и отправляет результат в текущий поток. Возвращает
+// false, если потока нет или отправить не удалось: тогда освободившееся место
+// объявляется при следующем подключении, а результат нужно отправить отдельно.
+func (s *streamSlots) finish(result *pb.TaskResultRequest) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.busy--
+	if s.stream == nil {
+		return false
+	}
+	if err := s.stream.Send(&pb.AgentMessage{FreeSlots: 1, Result: result}); err != nil {
+		s.stream = nil
+		return false
+	}
+	return true
+}
+
+// streamTasks открывает поток задач и выполняет полученные задачи, пока поток не
+// разорвется. Если результат не удалось отправить в поток, он отправляется
+// отдельным запросом.
+func streamTasks(client pb.OrchestratorServiceClient, agentID string, slots *streamSlots) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, agentIDMetadata, agentID)
+
+	stream, err := client.StreamTasks(ctx)
+	if err != nil {
+		return err
+	}
+	defer slots.close(stream)
+
+	if err := slots.open(stream); err != nil {
+		if err == io.EOF {
+			// Причина закрытия потока, например, Unimplemented, возвращается из Recv
+			_, err = stream.Recv()
+		}
+		return err
+	}
+	for {
+		task, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		slots.take()
+		go func() {
+			result := performTask(task)
+			if !slots.finish(result) {
+				if err := sendResult(client, result); err != nil {
+					log.Println("Error sending result:", err)
+				}
+			}
+		}()
+	}
+}
+
+func getTask(client pb.OrchestratorServiceClient, agentID string) *pb.Task {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, agentIDMetadata, agentID)
 
 	response, err := client.GetTask(ctx, &pb.Empty{})
 	if err != nil {
@@ -60,33 +392,155 @@ func getTask(client pb.OrchestratorServiceClient) *pb.Task {
 	return response.Task
 }
 
+// getTasks запрашивает до count задач для агента agentID.
+func getTasks(client pb.OrchestratorServiceClient, agentID string, count int) ([]*pb.Task, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, agentIDMetadata, agentID)
+
+	response, err := client.GetTasks(ctx, &pb.GetTasksRequest{MaxCount: int32(count)})
+	if err != nil {
+		return nil, err
+	}
+	return response.Tasks, nil
+}
+
+// taskError описывает ошибку выполнения задачи, которая передается оркестратору.
+type taskError struct {
+	code    string
+	message string
+}
+
+func (e *taskError) Error() string {
+	return e.message
+}
+
 func performTask(task *pb.Task) *pb.TaskResultRequest {
 	wait := time.Now().Add(time.Duration(task.OperationTime) * time.Millisecond)
 
-	var result float64
-	switch task.Operation {
-	case "+":
-		result = task.Arg1 + task.Arg2
-	case "-":
-		result = task.Arg1 - task.Arg2
-	case "*":
-		result = task.Arg1 * task.Arg2
-	case "/":
-		if task.Arg2 != 0 {
-			result = task.Arg1 / task.Arg2
-		} else {
-			result = 0
+	response := &pb.TaskResultRequest{Id: task.Id}
+	var err error
+	if calc.IsExactMode(task.Mode) {
+		// В точном режиме результат вычисляется по строкам без потери точности
+		response.ExactResult, response.Result, err = calculateExact(task)
+	} else {
+		response.Result, err = calculate(task)
+	}
+	if err != nil {
+		var taskErr *taskError
+		if errors.As(err, &taskErr) {
+			response.ErrorCode = taskErr.code
 		}
-	default:
-		result = 0
+		response.ErrorMessage = err.Error()
+		response.Result = 0
+		response.ExactResult = ""
 	}
 
 	time.Sleep(time.Until(wait))
 
-	return &pb.TaskResultRequest{
-		Id:     task.Id,
-		Result: result,
+	return response
+}
+
+// checkOperation находит операцию в реестре агента и проверяет число аргументов.
+func checkOperation(operation string, argc int) (Operation, error) {
+	op, ok := lookupOperation(operation)
+	if !ok {
+		return nil, &taskError{calc.ErrCodeUnsupportedOperation, fmt.Sprintf("неподдерживаемая операция %q", operation)}
+	}
+	if min, max := op.Arity(); argc < min || (max >= 0 && argc > max) {
+		return nil, &taskError{calc.ErrCodeArgumentCount, fmt.Sprintf("некорректное число аргументов функции %q: %d", operation, argc)}
+	}
+	return op, nil
+}
+
+// taskArgs возвращает аргументы задачи. Если Args не заполнены, аргументы
+// операторов берутся из Arg1 и Arg2.
+func taskArgs(task *pb.Task) []float64 {
+	if len(task.Args) > 0 {
+		return task.Args
 	}
+	switch task.Operation {
+	case "+", "-", "*", "/", "%", "^":
+		return []float64{task.Arg1, task.Arg2}
+	case "~":
+		return []float64{task.Arg1}
+	}
+	return task.Args
+}
+
+// calculate вычисляет результат задачи в float64.
+func calculate(task *pb.Task) (float64, error) {
+	args := taskArgs(task)
+	op, err := checkOperation(task.Operation, len(args))
+	if err != nil {
+		return 0, err
+	}
+	result, err := op.Calculate(args)
+	if errors.Is(err, calc.ErrDivisionByZero) {
+		return 0, errDivisionByZero
+	}
+	if errors.Is(err, calc.ErrInvalidNumber) {
+		return 0, &taskError{calc.ErrCodeInvalidNumber, err.Error()}
+	}
+	if err != nil {
+		return 0, err
+	}
+	// Аргументы вне области определения функции дают NaN или бесконечность,
+	// например, sqrt(-1) или ln(0): такой результат не сохраняется как успешный
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, &taskError{calc.ErrCodeInvalidNumber, fmt.Sprintf("результат операции %q не является конечным числом", task.Operation)}
+	}
+	return result, nil
+}
+
+// calculateExact вычисляет результат задачи в точном режиме и возвращает его
+// вместе с ближайшим значением float64. Операции, добавленные через Register,
+// вычисляются в float64, а результат переводится в запись режима.
+func calculateExact(task *pb.Task) (string, float64, error) {
+	op, err := checkOperation(task.Operation, len(task.ExactArgs))
+	if err != nil {
+		return "", 0, err
+	}
+	if builtin, ok := op.(*funcOperation); !ok || !builtin.exact {
+		return calculateFloat(op, task.Mode, task.ExactArgs)
+	}
+	exact, err := calc.ExactOperation(task.Mode, task.Operation, task.ExactArgs)
+	if errors.Is(err, calc.ErrDivisionByZero) {
+		return "", 0, errDivisionByZero
+	}
+	if err != nil {
+		return "", 0, &taskError{calc.ErrCodeInvalidNumber, err.Error()}
+	}
+	x, err := calc.ParseExact(exact)
+	if err != nil {
+		return "", 0, &taskError{calc.ErrCodeInvalidNumber, err.Error()}
+	}
+	return exact, calc.ExactToFloat(x), nil
+}
+
+// calculateFloat вычисляет операцию над точными значениями в float64 и возвращает
+// результат в записи режима mode вместе с его значением float64.
+func calculateFloat(op Operation, mode string, exactArgs []string) (string, float64, error) {
+	args := make([]float64, len(exactArgs))
+	for i, arg := range exactArgs {
+		x, err := calc.ParseExact(arg)
+		if err != nil {
+			return "", 0, &taskError{calc.ErrCodeInvalidNumber, err.Error()}
+		}
+		args[i] = calc.ExactToFloat(x)
+	}
+	result, err := op.Calculate(args)
+	if errors.Is(err, calc.ErrDivisionByZero) {
+		return "", 0, errDivisionByZero
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	x, err := calc.ExactFromFloat(result)
+	if err != nil {
+		return "", 0, &taskError{calc.ErrCodeInvalidNumber, err.Error()}
+	}
+	return calc.FormatExact(x, mode), result, nil
 }
 
 func sendResult(client pb.OrchestratorServiceClient, result *pb.TaskResultRequest) error {
@@ -100,3 +554,18 @@ func sendResult(client pb.OrchestratorServiceClient, result *pb.TaskResultReques
 
 	return nil
 }
+
+// sendResults отправляет результаты нескольких задач одним запросом.
+func sendResults(client pb.OrchestratorServiceClient, results []*pb.TaskResultRequest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	response, err := client.SendResults(ctx, &pb.SendResultsRequest{Results: results})
+	if err != nil {
+		return fmt.Errorf("error sending results: %w", err)
+	}
+	for _, id := range response.UnknownIds {
+		log.Printf("Orchestrator discarded result of unknown task %s", id)
+	}
+	return nil
+}
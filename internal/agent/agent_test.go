@@ -3,16 +3,53 @@ package agent
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"math"
 	"testing"
 	"time"
 
 	pb "github.com/denis-gr/GOCACL_DISTRIBUTED/internal/gen"
+	"github.com/denis-gr/GOCACL_DISTRIBUTED/pkg/calc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Mock для pb.OrchestratorServiceClient
 type mockOrchestratorServiceClient struct {
 	pb.UnimplementedOrchestratorServiceServer
+	stream    *mockTaskStream // Поток задач, nil — оркестратор не поддерживает потоки
+	noBatch   bool            // Оркестратор не поддерживает пакетные запросы
+	requested []int32         // Число задач в каждом вызове GetTasks
+	sent      [][]*pb.TaskResultRequest
+}
+
+// Mock для pb.OrchestratorService_StreamTasksClient
+type mockTaskStream struct {
+	grpc.ClientStream
+	tasks chan *pb.Task
+	sent  chan *pb.AgentMessage
+}
+
+func (s *mockTaskStream) Send(msg *pb.AgentMessage) error {
+	s.sent <- msg
+	return nil
+}
+
+func (s *mockTaskStream) Recv() (*pb.Task, error) {
+	task, ok := <-s.tasks
+	if !ok {
+		return nil, io.EOF
+	}
+	return task, nil
+}
+
+func (m *mockOrchestratorServiceClient) StreamTasks(ctx context.Context, opts ...grpc.CallOption) (pb.OrchestratorService_StreamTasksClient, error) {
+	if m.stream == nil {
+		return nil, status.Error(codes.Unimplemented, "method StreamTasks not implemented")
+	}
+	return m.stream, nil
 }
 
 func (m *mockOrchestratorServiceClient) GetTask(ctx context.Context, req *pb.Empty, opts ...grpc.CallOption) (*pb.TaskResponse, error) {
@@ -23,6 +60,36 @@ func (m *mockOrchestratorServiceClient) SendResult(ctx context.Context, req *pb.
 	return &pb.Empty{}, nil
 }
 
+func (m *mockOrchestratorServiceClient) GetTasks(ctx context.Context, req *pb.GetTasksRequest, opts ...grpc.CallOption) (*pb.TasksResponse, error) {
+	if m.noBatch {
+		return nil, status.Error(codes.Unimplemented, "method GetTasks not implemented")
+	}
+	m.requested = append(m.requested, req.MaxCount)
+	res := &pb.TasksResponse{}
+	for i := int32(0); i < req.MaxCount; i++ {
+		id := fmt.Sprintf("%d-%d", len(m.requested), i)
+		res.Tasks = append(res.Tasks, &pb.Task{Id: id, Operation: "+", Arg1: 1, Arg2: 1})
+	}
+	return res, nil
+}
+
+func (m *mockOrchestratorServiceClient) SendResults(ctx context.Context, req *pb.SendResultsRequest, opts ...grpc.CallOption) (*pb.SendResultsResponse, error) {
+	m.sent = append(m.sent, req.Results)
+	return &pb.SendResultsResponse{}, nil
+}
+
+func (m *mockOrchestratorServiceClient) CancelExpression(ctx context.Context, req *pb.CancelExpressionRequest, opts ...grpc.CallOption) (*pb.Empty, error) {
+	return &pb.Empty{}, nil
+}
+
+func (m *mockOrchestratorServiceClient) RegisterAgent(ctx context.Context, req *pb.AgentInfo, opts ...grpc.CallOption) (*pb.AgentResponse, error) {
+	return &pb.AgentResponse{HeartbeatIntervalMs: 500}, nil
+}
+
+func (m *mockOrchestratorServiceClient) Heartbeat(ctx context.Context, req *pb.AgentInfo, opts ...grpc.CallOption) (*pb.AgentResponse, error) {
+	return &pb.AgentResponse{}, nil
+}
+
 func TestPerformTask(t *testing.T) {
 	tests := []struct {
 		task     pb.Task
@@ -33,9 +100,16 @@ func TestPerformTask(t *testing.T) {
 		{pb.Task{Operation: "*", Arg1: 2, Arg2: 2, OperationTime: 100}, 4},
 		{pb.Task{Operation: "/", Arg1: 4, Arg2: 2, OperationTime: 100}, 2},
 		{pb.Task{Operation: "/", Arg1: 4, Arg2: 0, OperationTime: 100}, 0},
+		{pb.Task{Operation: "%", Arg1: 7, Arg2: 3, OperationTime: 100}, 1},
+		{pb.Task{Operation: "^", Arg1: 2, Arg2: 3, OperationTime: 100}, 8},
+		{pb.Task{Operation: "~", Arg1: 2, OperationTime: 100}, -2},
+		{pb.Task{Operation: "sqrt", Arg1: 16, Args: []float64{16}, OperationTime: 100}, 4},
+		{pb.Task{Operation: "max", Arg1: 1, Arg2: 5, Args: []float64{1, 5, 3}, OperationTime: 100}, 5},
+		{pb.Task{Operation: "sqrt", Args: []float64{}, OperationTime: 100}, 0},
 	}
 
-	for _, test := range tests {
+	for i := range tests {
+		test := &tests[i]
 		start := time.Now()
 		result := performTask(&test.task)
 		duration := time.Since(start)
@@ -55,6 +129,9 @@ func TestPerformTask(t *testing.T) {
 	if result.Result != 0 {
 		t.Errorf("expected 0, got %f", result.Result)
 	}
+	if result.ErrorCode != calc.ErrCodeUnsupportedOperation {
+		t.Errorf("expected error code %s, got %q", calc.ErrCodeUnsupportedOperation, result.ErrorCode)
+	}
 
 	// Тесты с нулевым ожиданием
 	task = pb.Task{Operation: "+", Arg1: 1, Arg2: 1, OperationTime: 0}
@@ -73,7 +150,7 @@ func TestPerformTask(t *testing.T) {
 
 func TestGetTask(t *testing.T) {
 	client := &mockOrchestratorServiceClient{}
-	task := getTask(client)
+	task := getTask(client, "agent-1")
 	if task == nil || task.Id != "1" {
 		t.Errorf("unexpected task: %+v", task)
 	}
@@ -87,3 +164,262 @@ func TestSendResult(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
+
+func TestPerformTaskExact(t *testing.T) {
+	tests := []struct {
+		task     pb.Task
+		expected string
+	}{
+		{pb.Task{Operation: "+", Arg1: 0.1, Arg2: 0.2, Mode: "decimal", ExactArgs: []string{"0.1", "0.2"}}, "0.3"},
+		{pb.Task{Operation: "*", Mode: "decimal", ExactArgs: []string{"12345678901234567890", "3"}}, "37037036703703703670"},
+		{pb.Task{Operation: "/", Mode: "rational", ExactArgs: []string{"1", "3"}}, "1/3"},
+		{pb.Task{Operation: "*", Mode: "rational", ExactArgs: []string{"1/3", "3"}}, "1"},
+	}
+
+	for i := range tests {
+		test := &tests[i]
+		result := performTask(&test.task)
+		if result.ExactResult != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, result.ExactResult)
+		}
+	}
+}
+
+func TestPerformTaskErrors(t *testing.T) {
+	tests := []struct {
+		task pb.Task
+		code string
+	}{
+		{pb.Task{Operation: "/", Arg1: 4, Arg2: 0}, calc.ErrCodeDivisionByZero},
+		{pb.Task{Operation: "%", Arg1: 4, Arg2: 0}, calc.ErrCodeDivisionByZero},
+		{pb.Task{Operation: "sqrt", Args: []float64{}}, calc.ErrCodeArgumentCount},
+		{pb.Task{Operation: "invalid", Args: []float64{1}}, calc.ErrCodeUnsupportedOperation},
+		{pb.Task{Operation: "/", Mode: "decimal", ExactArgs: []string{"1", "0"}}, calc.ErrCodeDivisionByZero},
+		{pb.Task{Operation: "+", Mode: "decimal", ExactArgs: []string{"1", "abc"}}, calc.ErrCodeInvalidNumber},
+		{pb.Task{Operation: "invalid", Mode: "rational", ExactArgs: []string{"1"}}, calc.ErrCodeUnsupportedOperation},
+		{pb.Task{Operation: "sqrt", Args: []float64{-1}}, calc.ErrCodeInvalidNumber},
+		{pb.Task{Operation: "ln", Args: []float64{0}}, calc.ErrCodeInvalidNumber},
+		{pb.Task{Operation: "log", Args: []float64{-1}}, calc.ErrCodeInvalidNumber},
+		{pb.Task{Operation: "^", Arg1: 0, Arg2: -1}, calc.ErrCodeInvalidNumber},
+		{pb.Task{Operation: "^", Arg1: -8, Arg2: 1.0 / 3}, calc.ErrCodeInvalidNumber},
+		{pb.Task{Operation: "%", Args: []float64{math.Inf(1), 2}}, calc.ErrCodeInvalidNumber},
+	}
+
+	for i := range tests {
+		test := &tests[i]
+		result := performTask(&test.task)
+		if result.ErrorCode != test.code || result.ErrorMessage == "" {
+			t.Errorf("%s: expected error code %s, got %q (%q)", test.task.Operation, test.code, result.ErrorCode, result.ErrorMessage)
+		}
+		if result.Result != 0 || result.ExactResult != "" {
+			t.Errorf("%s: expected no result, got %v (%q)", test.task.Operation, result.Result, result.ExactResult)
+		}
+	}
+
+	task := pb.Task{Operation: "+", Arg1: 1, Arg2: 1}
+	if result := performTask(&task); result.ErrorCode != "" || result.ErrorMessage != "" {
+		t.Errorf("expected no error, got %q (%q)", result.ErrorCode, result.ErrorMessage)
+	}
+}
+
+func TestRegisterAgent(t *testing.T) {
+	t.Setenv("AGENT_ID", "agent-1")
+	info := NewAgentInfo(3)
+	if info.AgentId != "agent-1" || info.Capacity != 3 || info.Version != Version {
+		t.Errorf("unexpected agent info: %+v", info)
+	}
+	for _, op := range []string{"+", "~", "sqrt", "max"} {
+		found := false
+		for _, supported := range info.Operations {
+			found = found || supported == op
+		}
+		if !found {
+			t.Errorf("expected operation %q in %v", op, info.Operations)
+		}
+	}
+
+	client := &mockOrchestratorServiceClient{}
+	interval, err := registerAgent(client, info)
+	if err != nil || interval != 500*time.Millisecond {
+		t.Errorf("unexpected interval %v, error %v", interval, err)
+	}
+	// Оркестратор не задал интервал, используется интервал по умолчанию
+	interval, err = sendHeartbeat(client, info)
+	if err != nil || interval != defaultHeartbeatInterval {
+		t.Errorf("unexpected interval %v, error %v", interval, err)
+	}
+}
+
+func TestStreamTasks(t *testing.T) {
+	stream := &mockTaskStream{tasks: make(chan *pb.Task), sent: make(chan *pb.AgentMessage, 10)}
+	client := &mockOrchestratorServiceClient{stream: stream}
+	slots := &streamSlots{capacity: 2}
+	done := make(chan error)
+	go func() {
+		done <- streamTasks(client, "agent-1", slots)
+	}()
+
+	if msg := <-stream.sent; msg.FreeSlots != 2 || msg.Result != nil {
+		t.Fatalf("expected 2 free slots to be announced, got %+v", msg)
+	}
+	stream.tasks <- &pb.Task{Id: "1", Operation: "+", Arg1: 1, Arg2: 1}
+	stream.tasks <- &pb.Task{Id: "2", Operation: "*", Arg1: 2, Arg2: 3}
+	results := map[string]float64{}
+	for i := 0; i < 2; i++ {
+		msg := <-stream.sent
+		if msg.FreeSlots != 1 || msg.Result == nil {
+			t.Fatalf("expected a result with a freed slot, got %+v", msg)
+		}
+		results[msg.Result.Id] = msg.Result.Result
+	}
+	if results["1"] != 2 || results["2"] != 6 {
+		t.Errorf("unexpected results: %v", results)
+	}
+	close(stream.tasks)
+	if err := <-done; err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+	if slots.busy != 0 || slots.stream != nil {
+		t.Errorf("expected no busy slots and no current stream, got %d, %v", slots.busy, slots.stream)
+	}
+
+	// Оркестратор без потоковой выдачи задач
+	err := streamTasks(&mockOrchestratorServiceClient{}, "agent-1", slots)
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected Unimplemented, got %v", err)
+	}
+}
+
+func TestStreamTasksReconnect(t *testing.T) {
+	first := &mockTaskStream{tasks: make(chan *pb.Task), sent: make(chan *pb.AgentMessage, 10)}
+	client := &mockOrchestratorServiceClient{stream: first}
+	slots := &streamSlots{capacity: 2}
+	done := make(chan error)
+	go func() {
+		done <- streamTasks(client, "agent-1", slots)
+	}()
+	<-first.sent
+	first.tasks <- &pb.Task{Id: "slow", Operation: "+", Arg1: 1, Arg2: 1, OperationTime: 300}
+	close(first.tasks)
+	<-done
+
+	// Пока задача из разорванного потока выполняется, объявляется одно свободное место
+	second := &mockTaskStream{tasks: make(chan *pb.Task), sent: make(chan *pb.AgentMessage, 10)}
+	client.stream = second
+	go func() {
+		done <- streamTasks(client, "agent-1", slots)
+	}()
+	if msg := <-second.sent; msg.FreeSlots != 1 || msg.Result != nil {
+		t.Fatalf("expected 1 free slot to be announced, got %+v", msg)
+	}
+	// Выполненная задача освобождает место в новом потоке
+	if msg := <-second.sent; msg.FreeSlots != 1 || msg.Result == nil || msg.Result.Id != "slow" {
+		t.Fatalf("expected the result with a freed slot in the new stream, got %+v", msg)
+	}
+	close(second.tasks)
+	<-done
+	if len(first.sent) != 0 {
+		t.Errorf("expected nothing to be sent to the closed stream, got %d messages", len(first.sent))
+	}
+}
+
+func TestBatcherPoll(t *testing.T) {
+	client := &mockOrchestratorServiceClient{}
+	b := newBatcher(client, "agent-1", 3)
+	if err := b.poll(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.requested) != 1 || client.requested[0] != 3 || b.busy != 3 {
+		t.Fatalf("expected a batch of 3 tasks, requested %v, busy %d", client.requested, b.busy)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(b.results) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := b.poll(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.sent) != 1 || len(client.sent[0]) != 3 {
+		t.Fatalf("expected 3 results to be sent together, got %v", client.sent)
+	}
+	for _, result := range client.sent[0] {
+		if result.Result != 2 {
+			t.Errorf("unexpected result: %+v", result)
+		}
+	}
+	if len(client.requested) != 2 || client.requested[1] != 3 {
+		t.Errorf("expected freed slots to be requested again, requested %v", client.requested)
+	}
+
+	// Оркестратор без пакетных запросов
+	err := newBatcher(&mockOrchestratorServiceClient{noBatch: true}, "agent-1", 3).poll()
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected Unimplemented, got %v", err)
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels := parseLabels(" precision=big, zone=a,,=b,gpu")
+	expected := map[string]string{"precision": "big", "zone": "a", "gpu": ""}
+	if len(labels) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, labels)
+	}
+	for key, value := range expected {
+		if labels[key] != value {
+			t.Errorf("expected label %s=%q, got %q", key, value, labels[key])
+		}
+	}
+}
+
+func TestRegisterOperation(t *testing.T) {
+	Register(Func("test_hypot", 2, 2, func(args []float64) (float64, error) {
+		return math.Hypot(args[0], args[1]), nil
+	}))
+	Register(Func("test_inverse", 1, 1, func(args []float64) (float64, error) {
+		if args[0] == 0 {
+			return 0, calc.ErrDivisionByZero
+		}
+		return 1 / args[0], nil
+	}))
+
+	if result := performTask(&pb.Task{Operation: "test_hypot", Args: []float64{3, 4}}); result.Result != 5 || result.ErrorMessage != "" {
+		t.Errorf("expected 5, got %+v", result)
+	}
+	result := performTask(&pb.Task{Operation: "test_hypot", Mode: "decimal", ExactArgs: []string{"3", "4"}})
+	if result.ExactResult != "5" || result.Result != 5 {
+		t.Errorf("expected exact 5, got %+v", result)
+	}
+	if result := performTask(&pb.Task{Operation: "test_inverse", Args: []float64{0}}); result.ErrorCode != calc.ErrCodeDivisionByZero {
+		t.Errorf("expected division by zero, got %+v", result)
+	}
+	if result := performTask(&pb.Task{Operation: "test_hypot", Args: []float64{3}}); result.ErrorCode != calc.ErrCodeArgumentCount {
+		t.Errorf("expected invalid argument count, got %+v", result)
+	}
+
+	// Агент сообщает оркестратору о новых операциях вместе с числом аргументов
+	info := NewAgentInfo(1)
+	found := false
+	for _, function := range info.Functions {
+		if function.Name == "test_hypot" {
+			found = function.MinArgs == 2 && function.MaxArgs == 2
+		}
+		if function.Name == "+" {
+			t.Errorf("operator + must not be advertised as a function")
+		}
+	}
+	if !found {
+		t.Errorf("expected test_hypot(2..2) to be advertised, got %v", info.Functions)
+	}
+
+	for _, name := range []string{"test_hypot", "+", "2x", "a-b", ""} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected Register(%q) to panic", name)
+				}
+			}()
+			Register(Func(name, 1, 1, nil))
+		}()
+	}
+}
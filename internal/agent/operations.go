@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	pb "github.com/denis-gr/GOCACL_DISTRIBUTED/internal/gen"
+	"github.com/denis-gr/GOCACL_DISTRIBUTED/pkg/calc"
+)
+
+// Operation — операция, которую умеет выполнять агент. Кроме встроенных операторов
+// и функций агент выполняет операции, добавленные в реестр функцией Register.
+// Такие операции вызываются в выражениях как функции: hypot(3, 4).
+type Operation interface {
+	// Name возвращает имя операции, под которым она вызывается в выражениях.
+	Name() string
+	// Arity возвращает наименьшее и наибольшее число аргументов, -1 — без ограничения.
+	Arity() (min, max int)
+	// Calculate вычисляет результат операции. Если операция возвращает
+	// calc.ErrDivisionByZero, оркестратору сообщается код division_by_zero, а если
+	// calc.ErrInvalidNumber, NaN или бесконечность — код invalid_number.
+	Calculate(args []float64) (float64, error)
+}
+
+// funcOperation — операция, заданная функцией.
+type funcOperation struct {
+	name    string
+	minArgs int
+	maxArgs int
+	f       func(args []float64) (float64, error)
+	exact   bool // Операция выполняется без потери точности с помощью calc.ExactOperation
+}
+
+func (op *funcOperation) Name() string { return op.name }
+
+func (op *funcOperation) Arity() (int, int) { return op.minArgs, op.maxArgs }
+
+func (op *funcOperation) Calculate(args []float64) (float64, error) { return op.f(args) }
+
+// Func создает операцию из функции, которая принимает от minArgs до maxArgs
+// аргументов (maxArgs -1 — без ограничения).
+// Пример: Func("hypot", 2, 2, func(args []float64) (float64, error) { return math.Hypot(args[0], args[1]), nil })
+func Func(name string, minArgs, maxArgs int, f func(args []float64) (float64, error)) Operation {
+	return &funcOperation{name: name, minArgs: minArgs, maxArgs: maxArgs, f: f}
+}
+
+// registry содержит операции агента по именам.
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Operation)
+)
+
+// Register добавляет операцию в реестр агента. Обычно вызывается из функции init
+// пакета, который подключается к агенту при сборке. Агент сообщает оркестратору
+// имена и число аргументов зарегистрированных операций, и оркестратор принимает
+// их в выражениях как вызовы функций. В точном режиме такие операции вычисляются
+// в float64. Паникует, если имя операции не может быть именем функции или
+// операция с таким именем уже есть.
+func Register(op Operation) {
+	if !isFunctionName(op.Name()) {
+		panic(fmt.Sprintf("agent: invalid operation name %q", op.Name()))
+	}
+	register(op)
+}
+
+func register(op Operation) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[op.Name()]; ok {
+		panic(fmt.Sprintf("agent: operation %q is already registered", op.Name()))
+	}
+	registry[op.Name()] = op
+}
+
+// lookupOperation возвращает операцию из реестра.
+func lookupOperation(name string) (Operation, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	op, ok := registry[name]
+	return op, ok
+}
+
+// isFunctionName проверяет, что имя можно вызвать в выражении как функцию:
+// оно начинается с латинской буквы или "_" и состоит из букв, цифр и "_".
+func isFunctionName(name string) bool {
+	for i, r := range name {
+		letter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_'
+		if !letter && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// Operations возвращает операции, которые умеет выполнять агент, в алфавитном порядке.
+func Operations() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	operations := make([]string, 0, len(registry))
+	for name := range registry {
+		operations = append(operations, name)
+	}
+	sort.Strings(operations)
+	return operations
+}
+
+// functionInfos описывает операции агента, которые вызываются в выражениях
+// как функции, в алфавитном порядке.
+func functionInfos() []*pb.FunctionInfo {
+	var infos []*pb.FunctionInfo
+	for _, name := range Operations() {
+		if !isFunctionName(name) {
+			continue
+		}
+		op, _ := lookupOperation(name)
+		min, max := op.Arity()
+		infos = append(infos, &pb.FunctionInfo{Name: name, MinArgs: int32(min), MaxArgs: int32(max)})
+	}
+	return infos
+}
+
+// finite возвращает calc.ErrInvalidNumber, если результат не является конечным числом.
+// Пример: 0^-1 -> +Inf, (-8)^(1/3) -> NaN
+func finite(x float64) (float64, error) {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return 0, calc.ErrInvalidNumber
+	}
+	return x, nil
+}
+
+// binary создает встроенный оператор двух аргументов.
+func binary(name string, f func(a, b float64) (float64, error)) *funcOperation {
+	return &funcOperation{name: name, minArgs: 2, maxArgs: 2, exact: true, f: func(args []float64) (float64, error) {
+		return f(args[0], args[1])
+	}}
+}
+
+// Встроенные операторы и функции по умолчанию из пакета calc.
+func init() {
+	register(binary("+", func(a, b float64) (float64, error) { return a + b, nil }))
+	register(binary("-", func(a, b float64) (float64, error) { return a - b, nil }))
+	register(binary("*", func(a, b float64) (float64, error) { return a * b, nil }))
+	register(binary("/", func(a, b float64) (float64, error) {
+		if b == 0 {
+			return 0, calc.ErrDivisionByZero
+		}
+		return a / b, nil
+	}))
+	register(binary("%", func(a, b float64) (float64, error) {
+		if b == 0 {
+			return 0, calc.ErrDivisionByZero
+		}
+		return finite(math.Mod(a, b))
+	}))
+	register(binary("^", func(a, b float64) (float64, error) { return finite(math.Pow(a, b)) }))
+	register(&funcOperation{name: "~", minArgs: 1, maxArgs: 1, exact: true, f: func(args []float64) (float64, error) {
+		return -args[0], nil
+	}})
+	for name, function := range calc.DefaultFunctions() {
+		register(&funcOperation{name: name, minArgs: function.MinArgs, maxArgs: function.MaxArgs, exact: true,
+			f: func(args []float64) (float64, error) {
+				return function.Func(args...), nil
+			}})
+	}
+}
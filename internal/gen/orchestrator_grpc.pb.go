@@ -26,6 +26,23 @@ type OrchestratorServiceClient interface {
 	GetTask(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*TaskResponse, error)
 	// Отправить результат выполнения задачи.
 	SendResult(ctx context.Context, in *TaskResultRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Отменить вычисление выражения и снять его задачи.
+	CancelExpression(ctx context.Context, in *CancelExpressionRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Зарегистрировать агента. Задачи, выданные предыдущему запуску агента с тем же
+	// идентификатором, сразу возвращаются в очередь.
+	RegisterAgent(ctx context.Context, in *AgentInfo, opts ...grpc.CallOption) (*AgentResponse, error)
+	// Сообщить, что агент жив. Если агент не сообщает об этом дольше AGENT_TIMEOUT_MS,
+	// выданные ему задачи возвращаются в очередь.
+	Heartbeat(ctx context.Context, in *AgentInfo, opts ...grpc.CallOption) (*AgentResponse, error)
+	// Получить до max_count задач за один запрос. Идентификатор агента передается
+	// в метаданных x-agent-id.
+	GetTasks(ctx context.Context, in *GetTasksRequest, opts ...grpc.CallOption) (*TasksResponse, error)
+	// Отправить результаты нескольких задач за один запрос.
+	SendResults(ctx context.Context, in *SendResultsRequest, opts ...grpc.CallOption) (*SendResultsResponse, error)
+	// Получать задачи в потоке. Агент объявляет свободные места и возвращает
+	// результаты, а оркестратор отправляет задачи, как только они готовы.
+	// Идентификатор агента передается в метаданных x-agent-id.
+	StreamTasks(ctx context.Context, opts ...grpc.CallOption) (OrchestratorService_StreamTasksClient, error)
 }
 
 type orchestratorServiceClient struct {
@@ -54,6 +71,82 @@ func (c *orchestratorServiceClient) SendResult(ctx context.Context, in *TaskResu
 	return out, nil
 }
 
+func (c *orchestratorServiceClient) CancelExpression(ctx context.Context, in *CancelExpressionRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/orchestrator.OrchestratorService/CancelExpression", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorServiceClient) RegisterAgent(ctx context.Context, in *AgentInfo, opts ...grpc.CallOption) (*AgentResponse, error) {
+	out := new(AgentResponse)
+	err := c.cc.Invoke(ctx, "/orchestrator.OrchestratorService/RegisterAgent", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorServiceClient) Heartbeat(ctx context.Context, in *AgentInfo, opts ...grpc.CallOption) (*AgentResponse, error) {
+	out := new(AgentResponse)
+	err := c.cc.Invoke(ctx, "/orchestrator.OrchestratorService/Heartbeat", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorServiceClient) GetTasks(ctx context.Context, in *GetTasksRequest, opts ...grpc.CallOption) (*TasksResponse, error) {
+	out := new(TasksResponse)
+	err := c.cc.Invoke(ctx, "/orchestrator.OrchestratorService/GetTasks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorServiceClient) SendResults(ctx context.Context, in *SendResultsRequest, opts ...grpc.CallOption) (*SendResultsResponse, error) {
+	out := new(SendResultsResponse)
+	err := c.cc.Invoke(ctx, "/orchestrator.OrchestratorService/SendResults", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorServiceClient) StreamTasks(ctx context.Context, opts ...grpc.CallOption) (OrchestratorService_StreamTasksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &OrchestratorService_ServiceDesc.Streams[0], "/orchestrator.OrchestratorService/StreamTasks", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &orchestratorServiceStreamTasksClient{stream}
+	return x, nil
+}
+
+type OrchestratorService_StreamTasksClient interface {
+	Send(*AgentMessage) error
+	Recv() (*Task, error)
+	grpc.ClientStream
+}
+
+type orchestratorServiceStreamTasksClient struct {
+	grpc.ClientStream
+}
+
+func (x *orchestratorServiceStreamTasksClient) Send(m *AgentMessage) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *orchestratorServiceStreamTasksClient) Recv() (*Task, error) {
+	m := new(Task)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // OrchestratorServiceServer is the server API for OrchestratorService service.
 // All implementations should embed UnimplementedOrchestratorServiceServer
 // for forward compatibility
@@ -62,6 +155,23 @@ type OrchestratorServiceServer interface {
 	GetTask(context.Context, *Empty) (*TaskResponse, error)
 	// Отправить результат выполнения задачи.
 	SendResult(context.Context, *TaskResultRequest) (*Empty, error)
+	// Отменить вычисление выражения и снять его задачи.
+	CancelExpression(context.Context, *CancelExpressionRequest) (*Empty, error)
+	// Зарегистрировать агента. Задачи, выданные предыдущему запуску агента с тем же
+	// идентификатором, сразу возвращаются в очередь.
+	RegisterAgent(context.Context, *AgentInfo) (*AgentResponse, error)
+	// Сообщить, что агент жив. Если агент не сообщает об этом дольше AGENT_TIMEOUT_MS,
+	// выданные ему задачи возвращаются в очередь.
+	Heartbeat(context.Context, *AgentInfo) (*AgentResponse, error)
+	// Получить до max_count задач за один запрос. Идентификатор агента передается
+	// в метаданных x-agent-id.
+	GetTasks(context.Context, *GetTasksRequest) (*TasksResponse, error)
+	// Отправить результаты нескольких задач за один запрос.
+	SendResults(context.Context, *SendResultsRequest) (*SendResultsResponse, error)
+	// Получать задачи в потоке. Агент объявляет свободные места и возвращает
+	// результаты, а оркестратор отправляет задачи, как только они готовы.
+	// Идентификатор агента передается в метаданных x-agent-id.
+	StreamTasks(OrchestratorService_StreamTasksServer) error
 }
 
 // UnimplementedOrchestratorServiceServer should be embedded to have forward compatible implementations.
@@ -74,6 +184,24 @@ func (UnimplementedOrchestratorServiceServer) GetTask(context.Context, *Empty) (
 func (UnimplementedOrchestratorServiceServer) SendResult(context.Context, *TaskResultRequest) (*Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SendResult not implemented")
 }
+func (UnimplementedOrchestratorServiceServer) CancelExpression(context.Context, *CancelExpressionRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelExpression not implemented")
+}
+func (UnimplementedOrchestratorServiceServer) RegisterAgent(context.Context, *AgentInfo) (*AgentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterAgent not implemented")
+}
+func (UnimplementedOrchestratorServiceServer) Heartbeat(context.Context, *AgentInfo) (*AgentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Heartbeat not implemented")
+}
+func (UnimplementedOrchestratorServiceServer) GetTasks(context.Context, *GetTasksRequest) (*TasksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTasks not implemented")
+}
+func (UnimplementedOrchestratorServiceServer) SendResults(context.Context, *SendResultsRequest) (*SendResultsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendResults not implemented")
+}
+func (UnimplementedOrchestratorServiceServer) StreamTasks(OrchestratorService_StreamTasksServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamTasks not implemented")
+}
 
 // UnsafeOrchestratorServiceServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to OrchestratorServiceServer will
@@ -122,6 +250,122 @@ func _OrchestratorService_SendResult_Handler(srv interface{}, ctx context.Contex
 	return interceptor(ctx, in, info, handler)
 }
 
+func _OrchestratorService_CancelExpression_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelExpressionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServiceServer).CancelExpression(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/orchestrator.OrchestratorService/CancelExpression",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServiceServer).CancelExpression(ctx, req.(*CancelExpressionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrchestratorService_RegisterAgent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AgentInfo)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServiceServer).RegisterAgent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/orchestrator.OrchestratorService/RegisterAgent",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServiceServer).RegisterAgent(ctx, req.(*AgentInfo))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrchestratorService_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AgentInfo)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServiceServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/orchestrator.OrchestratorService/Heartbeat",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServiceServer).Heartbeat(ctx, req.(*AgentInfo))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrchestratorService_GetTasks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTasksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServiceServer).GetTasks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/orchestrator.OrchestratorService/GetTasks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServiceServer).GetTasks(ctx, req.(*GetTasksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrchestratorService_SendResults_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendResultsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServiceServer).SendResults(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/orchestrator.OrchestratorService/SendResults",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServiceServer).SendResults(ctx, req.(*SendResultsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrchestratorService_StreamTasks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(OrchestratorServiceServer).StreamTasks(&orchestratorServiceStreamTasksServer{stream})
+}
+
+type OrchestratorService_StreamTasksServer interface {
+	Send(*Task) error
+	Recv() (*AgentMessage, error)
+	grpc.ServerStream
+}
+
+type orchestratorServiceStreamTasksServer struct {
+	grpc.ServerStream
+}
+
+func (x *orchestratorServiceStreamTasksServer) Send(m *Task) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *orchestratorServiceStreamTasksServer) Recv() (*AgentMessage, error) {
+	m := new(AgentMessage)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // OrchestratorService_ServiceDesc is the grpc.ServiceDesc for OrchestratorService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -137,7 +381,34 @@ var OrchestratorService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SendResult",
 			Handler:    _OrchestratorService_SendResult_Handler,
 		},
+		{
+			MethodName: "CancelExpression",
+			Handler:    _OrchestratorService_CancelExpression_Handler,
+		},
+		{
+			MethodName: "RegisterAgent",
+			Handler:    _OrchestratorService_RegisterAgent_Handler,
+		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _OrchestratorService_Heartbeat_Handler,
+		},
+		{
+			MethodName: "GetTasks",
+			Handler:    _OrchestratorService_GetTasks_Handler,
+		},
+		{
+			MethodName: "SendResults",
+			Handler:    _OrchestratorService_SendResults_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamTasks",
+			Handler:       _OrchestratorService_StreamTasks_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/orchestrator.proto",
 }
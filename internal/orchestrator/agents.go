@@ -0,0 +1,275 @@
+package orchestrator
+
+import (
+	"errors"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/denis-gr/GOCACL_DISTRIBUTED/pkg/calc"
+)
+
+// ErrNoAgentID возвращается, если агент не передал свой идентификатор.
+var ErrNoAgentID = errors.New("agent id is required")
+
+// ErrNoMatchingAgent используется как статус выражения, задачу которого не может
+// выполнить ни один живой агент.
+var ErrNoMatchingAgent = errors.New("no live agent can run the task")
+
+// routingCheckInterval — как часто ищутся задачи, которые не может выполнить ни один агент.
+const routingCheckInterval = time.Second
+
+// agentHeartbeatInterval возвращает, как часто агенты должны сообщать, что они живы.
+func agentHeartbeatInterval() time.Duration {
+	interval, err := strconv.ParseInt(os.Getenv("AGENT_HEARTBEAT_MS"), 10, 64)
+	if err != nil || interval <= 0 {
+		interval = 2000
+	}
+	return time.Duration(interval) * time.Millisecond
+}
+
+// agentTimeout возвращает, через сколько агент без сигналов считается
+// остановленным. По умолчанию — три интервала сигналов.
+func agentTimeout() time.Duration {
+	timeout, err := strconv.ParseInt(os.Getenv("AGENT_TIMEOUT_MS"), 10, 64)
+	if err != nil || timeout <= 0 {
+		return 3 * agentHeartbeatInterval()
+	}
+	return time.Duration(timeout) * time.Millisecond
+}
+
+// taskRoutingTimeout возвращает, сколько задача может ждать в очереди, если ни один
+// живой агент не может ее выполнить. По умолчанию — минута.
+func taskRoutingTimeout() time.Duration {
+	timeout, err := strconv.ParseInt(os.Getenv("TASK_ROUTING_TIMEOUT_MS"), 10, 64)
+	if err != nil || timeout <= 0 {
+		timeout = 60000
+	}
+	return time.Duration(timeout) * time.Millisecond
+}
+
+// RegisterAgent регистрирует агента и возвращает интервал, с которым он должен
+// сообщать, что жив. Если агент с таким идентификатором уже был зарегистрирован,
+// значит, он перезапустился, и выданные ему задачи сразу возвращаются в очередь.
+func (f *DistributedCalculator) RegisterAgent(agent Agent) (time.Duration, error) {
+	if agent.ID == "" {
+		return 0, ErrNoAgentID
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.agents[agent.ID]; ok {
+		log.Printf("Agent %s restarted, returning its tasks to the queue", agent.ID)
+		f.releaseAgentLeases(agent.ID)
+	} else {
+		log.Printf("Agent %s registered on %s with capacity %d", agent.ID, agent.Hostname, agent.Capacity)
+	}
+	now := time.Now()
+	agent.RegisteredAt = now
+	agent.LastSeen = now
+	f.agents[agent.ID] = &agent
+	return agentHeartbeatInterval(), nil
+}
+
+// Heartbeat отмечает, что агент жив, и обновляет его описание. Агент, о котором
+// оркестратор не знает, например, после перезапуска оркестратора, регистрируется.
+func (f *DistributedCalculator) Heartbeat(agent Agent) (time.Duration, error) {
+	if agent.ID == "" {
+		return 0, ErrNoAgentID
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	if known, ok := f.agents[agent.ID]; ok {
+		agent.RegisteredAt = known.RegisteredAt
+	} else {
+		log.Printf("Agent %s registered by heartbeat on %s", agent.ID, agent.Hostname)
+		agent.RegisteredAt = now
+	}
+	agent.LastSeen = now
+	f.agents[agent.ID] = &agent
+	return agentHeartbeatInterval(), nil
+}
+
+// releaseDeadAgents забывает агентов, которые давно не сообщали, что живы,
+// и сразу возвращает выданные им задачи в очередь. Вызывается с захваченным f.mu.
+func (f *DistributedCalculator) releaseDeadAgents(now time.Time) {
+	timeout := agentTimeout()
+	for id, agent := range f.agents {
+		if now.Sub(agent.LastSeen) > timeout {
+			log.Printf("Agent %s stopped sending heartbeats, returning its tasks to the queue", id)
+			delete(f.agents, id)
+			f.releaseAgentLeases(id)
+		}
+	}
+}
+
+// watchAgents с интервалом сигналов забывает агентов, которые перестали их подавать,
+// чтобы их задачи возвращались в очередь, даже если задачи никто не запрашивает.
+func (f *DistributedCalculator) watchAgents() {
+	ticker := time.NewTicker(agentHeartbeatInterval())
+	defer ticker.Stop()
+	for now := range ticker.C {
+		f.mu.Lock()
+		f.releaseDeadAgents(now)
+		f.mu.Unlock()
+	}
+}
+
+// releaseAgentLeases возвращает в очередь задачи, выданные агенту.
+// Вызывается с захваченным f.mu.
+func (f *DistributedCalculator) releaseAgentLeases(agentID string) {
+	for taskID, owner := range f.taskAgents {
+		if owner == agentID {
+			f.releaseLease(taskID)
+		}
+	}
+}
+
+// canRun проверяет, может ли агент выполнить задачу: агент должен поддерживать
+// операцию задачи и иметь все метки из селектора ее выражения с теми же значениями.
+// Агент, не сообщивший свои операции, считается поддерживающим все операции.
+// Незарегистрированный агент (agent равен nil), например, агент API v0, получает
+// только задачи без селектора.
+func canRun(agent *Agent, task Task) bool {
+	if agent == nil {
+		return len(task.Selector) == 0
+	}
+	for key, value := range task.Selector {
+		if label, ok := agent.Labels[key]; !ok || label != value {
+			return false
+		}
+	}
+	return len(agent.Operations) == 0 || slices.Contains(agent.Operations, task.Operation)
+}
+
+// functions возвращает функции, которые можно вызывать в выражениях: функции по
+// умолчанию и функции, о которых сообщили живые агенты. Функции по умолчанию
+// агенты переопределить не могут. Если агенты сообщили разное число аргументов
+// одной функции, принимается любое число, допустимое хотя бы для одного агента.
+func (f *DistributedCalculator) functions() map[string]calc.Function {
+	functions := calc.DefaultFunctions()
+	custom := make(map[string]calc.Function)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.releaseDeadAgents(time.Now())
+	for _, agent := range f.agents {
+		for _, af := range agent.Functions {
+			if _, ok := functions[af.Name]; ok {
+				continue
+			}
+			function, ok := custom[af.Name]
+			if !ok {
+				custom[af.Name] = calc.Function{MinArgs: af.MinArgs, MaxArgs: af.MaxArgs}
+				continue
+			}
+			function.MinArgs = min(function.MinArgs, af.MinArgs)
+			if function.MaxArgs >= 0 && (af.MaxArgs < 0 || af.MaxArgs > function.MaxArgs) {
+				function.MaxArgs = af.MaxArgs
+			}
+			custom[af.Name] = function
+		}
+	}
+	for name, function := range custom {
+		functions[name] = function
+	}
+	return functions
+}
+
+// addSavedFunctions добавляет в functions функции выражения, сохраненного до
+// перезапуска. Выражение уже проверено при создании, а агенты, которые умеют
+// выполнять его функции, могут еще не успеть зарегистрироваться, поэтому
+// неизвестные функции принимаются с любым числом аргументов.
+func addSavedFunctions(functions map[string]calc.Function, expression string) {
+	root, err := calc.Parse(expression)
+	if err != nil {
+		return
+	}
+	var walk func(node calc.Node)
+	walk = func(node calc.Node) {
+		switch n := node.(type) {
+		case *calc.Unary:
+			walk(n.Operand)
+		case *calc.Binary:
+			walk(n.Left)
+			walk(n.Right)
+		case *calc.Call:
+			if _, ok := functions[n.Name]; !ok {
+				functions[n.Name] = calc.Function{MinArgs: 0, MaxArgs: -1}
+			}
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		}
+	}
+	walk(root)
+}
+
+// needsMatch проверяет, может ли в очереди быть задача, которую агент не сможет
+// выполнить. Если нет, задачи выдаются из очереди без проверки каждой из них.
+// Вызывается с захваченным f.mu.
+func (f *DistributedCalculator) needsMatch(agent *Agent) bool {
+	if f.queue.pinned > 0 {
+		return true
+	}
+	if agent == nil || len(agent.Operations) == 0 {
+		return false
+	}
+	for operation := range f.queue.operations {
+		if !slices.Contains(agent.Operations, operation) {
+			return true
+		}
+	}
+	return false
+}
+
+// failUnroutableTasks завершает с ошибкой ErrNoMatchingAgent выражения, задачи
+// которых ждут в очереди дольше TASK_ROUTING_TIMEOUT_MS, хотя ни один живой агент
+// не может их выполнить: не поддерживает операцию или не подходит под селектор.
+// Если живых агентов нет, задачи ждут, пока агенты появятся. Проверка выполняется
+// не чаще раза в секунду. Вызывается с захваченным f.mu.
+func (f *DistributedCalculator) failUnroutableTasks(now time.Time) {
+	if len(f.agents) == 0 || now.Sub(f.routedAt) < routingCheckInterval {
+		return
+	}
+	f.routedAt = now
+	for _, id := range f.queue.waitingSince(now.Add(-taskRoutingTimeout())) {
+		task, ok := f.tasks[id]
+		if !ok {
+			// Выражение уже завершено вместе с другой его задачей
+			continue
+		}
+		runnable := false
+		for _, agent := range f.agents {
+			if canRun(agent, task) {
+				runnable = true
+				break
+			}
+		}
+		if !runnable {
+			log.Printf("No live agent can run task %s (%s, selector %v)", id, task.Operation, task.Selector)
+			f.saveResult(f.taskNodes[id].exprID, 0, "", ErrNoMatchingAgent)
+		}
+	}
+}
+
+// GetAgents возвращает живых агентов, упорядоченных по идентификатору.
+func (f *DistributedCalculator) GetAgents() (AgentsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.releaseDeadAgents(time.Now())
+	leased := make(map[string]int)
+	for _, owner := range f.taskAgents {
+		leased[owner]++
+	}
+	agents := []Agent{}
+	for id, agent := range f.agents {
+		a := *agent
+		a.Leased = leased[id]
+		agents = append(agents, a)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].ID < agents[j].ID })
+	return AgentsResponse{Agents: agents}, nil
+}
@@ -0,0 +1,145 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/denis-gr/GOCACL_DISTRIBUTED/pkg/calc"
+	"github.com/google/uuid"
+)
+
+// ErrEmptyBatch возвращается, если в пакете нет выражений.
+var ErrEmptyBatch = errors.New("batch is empty")
+
+// ErrBatchTooLarge возвращается, если в пакете больше выражений, чем разрешено.
+var ErrBatchTooLarge = errors.New("batch is too large")
+
+// BatchItemError описывает ошибку в одном из выражений пакета.
+type BatchItemError struct {
+	Index int // Номер выражения в пакете, начиная с 0
+	Err   error
+}
+
+func (e *BatchItemError) Error() string {
+	return fmt.Sprintf("expression %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchItemError) Unwrap() error {
+	return e.Err
+}
+
+// maxBatchSize возвращает наибольшее число выражений в пакете.
+func maxBatchSize() int {
+	size, err := strconv.Atoi(os.Getenv("BATCH_MAX_SIZE"))
+	if err != nil || size <= 0 {
+		size = 10000
+	}
+	return size
+}
+
+// CalculateBatch запускает вычисление пакета выражений. Сначала проверяются все
+// выражения: если хотя бы одно некорректно, возвращается *BatchItemError и ничего
+// не сохраняется. Если пакет превышает ограничения пользователя, возвращается
+// *QuotaError. Затем выражения сохраняются в одной транзакции, а их первые
+// задачи — в другой.
+// Идентификаторы выражений возвращаются в порядке отправки.
+func (f *DistributedCalculator) CalculateBatch(creatorID string, reqs []CalculateRequest) (BatchCalculateResponse, error) {
+	if len(reqs) == 0 {
+		return BatchCalculateResponse{}, ErrEmptyBatch
+	}
+	if len(reqs) > maxBatchSize() {
+		return BatchCalculateResponse{}, ErrBatchTooLarge
+	}
+	graphs := make([]*calc.Graph, len(reqs))
+	functions := f.functions()
+	for i := range reqs {
+		graph, err := prepare(&reqs[i], functions)
+		if err != nil {
+			return BatchCalculateResponse{}, &BatchItemError{Index: i, Err: err}
+		}
+		if err := checkOperations(graph); err != nil {
+			return BatchCalculateResponse{}, &BatchItemError{Index: i, Err: err}
+		}
+		graphs[i] = graph
+	}
+	// Каждое выражение пакета считается отдельным запросом и вычисляемым выражением
+	if err := f.admit(creatorID, len(reqs)); err != nil {
+		return BatchCalculateResponse{}, err
+	}
+	defer f.release(creatorID, len(reqs))
+
+	batchID, _ := uuid.NewV7()
+	ids := make([]string, len(reqs))
+	for i := range reqs {
+		id, _ := uuid.NewV7()
+		ids[i] = id.String()
+	}
+	_, err := f.db.CreateExpressionsBatch(creatorID, batchID.String(), ids, reqs)
+	if err != nil {
+		return BatchCalculateResponse{}, err
+	}
+
+	// Выражения запускаются за один захват f.mu, а их первые задачи сохраняются
+	// одной транзакцией, чтобы большой пакет не задерживал агентов
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.newTasks = make([]newTask, 0, len(reqs))
+	for i, req := range reqs {
+		f.start(Expression{
+			ID:        ids[i],
+			Mode:      req.Mode,
+			Priority:  req.Priority,
+			Selector:  req.Selector,
+			CreatorID: creatorID,
+			BatchID:   batchID.String(),
+			Label:     req.Label,
+		}, graphs[i], nil)
+	}
+	tasks := make([]newTask, 0, len(f.newTasks))
+	for _, task := range f.newTasks {
+		// Задачи выражений, которые уже завершились, например, делением на ноль, не сохраняются
+		if _, ok := f.taskNodes[task.task.ID]; ok {
+			tasks = append(tasks, task)
+		}
+	}
+	f.newTasks = nil
+	if err := f.db.CreateTasks(tasks); err != nil {
+		log.Println(err)
+	}
+	return BatchCalculateResponse{BatchID: batchID.String(), IDs: ids}, nil
+}
+
+// GetBatch возвращает выражения пакета пользователя и сводку по их состоянию.
+// Для чужих и несуществующих пакетов возвращается ErrNotFound.
+func (f *DistributedCalculator) GetBatch(batchID, userID string) (BatchResponse, error) {
+	saved, err := f.db.GetExpressionsByBatchID(batchID)
+	if err != nil {
+		return BatchResponse{}, err
+	}
+	if len(saved) == 0 || saved[0].CreatorId != userID {
+		return BatchResponse{}, ErrNotFound
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := BatchResponse{ID: batchID, Total: len(saved), Expressions: make([]Expression, 0, len(saved))}
+	for _, v := range saved {
+		expr, ok := f.expressions[v.ID]
+		if !ok {
+			expr = expressionFromDB(v)
+		}
+		switch expr.Status {
+		case "running":
+			res.Running++
+		case "ok":
+			res.Done++
+		default:
+			res.Failed++
+		}
+		res.Expressions = append(res.Expressions, expr)
+	}
+	return res, nil
+}
@@ -2,9 +2,11 @@ package orchestrator
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"os"
 
+	"github.com/denis-gr/GOCACL_DISTRIBUTED/pkg/calc"
 	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
 	"golang.org/x/crypto/bcrypt"
@@ -37,6 +39,14 @@ func createTables(dbConnection *sql.DB) error {
         status TEXT NOT NULL,
         result REAL,
 		creator_id TEXT NOT NULL,
+		variables TEXT NOT NULL DEFAULT '{}',
+		mode TEXT NOT NULL DEFAULT 'float',
+		exact_result TEXT NOT NULL DEFAULT '',
+		batch_id TEXT NOT NULL DEFAULT '',
+		label TEXT NOT NULL DEFAULT '',
+		idempotency_key TEXT NOT NULL DEFAULT '',
+		priority INTEGER NOT NULL DEFAULT 0,
+		selector TEXT NOT NULL DEFAULT '{}',
 		FOREIGN KEY (creator_id) REFERENCES users(id)
     );`
 
@@ -47,6 +57,24 @@ func createTables(dbConnection *sql.DB) error {
         password_hash TEXT NOT NULL
     );`
 
+	taskTableQuery := `
+    CREATE TABLE IF NOT EXISTS tasks (
+        id TEXT PRIMARY KEY,
+        expression_id TEXT NOT NULL,
+        node INTEGER NOT NULL,
+        operation TEXT NOT NULL,
+        arg1 REAL NOT NULL,
+        arg2 REAL NOT NULL,
+        args TEXT NOT NULL DEFAULT '[]',
+        exact_args TEXT NOT NULL DEFAULT '[]',
+        operation_time INTEGER NOT NULL,
+        status TEXT NOT NULL,
+        result REAL,
+        exact_result TEXT NOT NULL DEFAULT '',
+        attempts INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY (expression_id) REFERENCES expressions(id)
+    );`
+
 	_, err := dbConnection.Exec(userTableQuery)
 	if err != nil {
 		return err
@@ -55,10 +83,94 @@ func createTables(dbConnection *sql.DB) error {
 	if err != nil {
 		return err
 	}
+	_, err = dbConnection.Exec(taskTableQuery)
+	if err != nil {
+		return err
+	}
+
+	// Столбцы, добавленные после создания таблиц, для уже существующих баз данных
+	err = addColumn(dbConnection, "tasks", "args", "TEXT NOT NULL DEFAULT '[]'")
+	if err != nil {
+		return err
+	}
+	err = addColumn(dbConnection, "expressions", "variables", "TEXT NOT NULL DEFAULT '{}'")
+	if err != nil {
+		return err
+	}
+	err = addColumn(dbConnection, "expressions", "mode", "TEXT NOT NULL DEFAULT 'float'")
+	if err != nil {
+		return err
+	}
+	err = addColumn(dbConnection, "expressions", "exact_result", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = addColumn(dbConnection, "expressions", "batch_id", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = addColumn(dbConnection, "expressions", "label", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = addColumn(dbConnection, "expressions", "idempotency_key", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = addColumn(dbConnection, "expressions", "priority", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = addColumn(dbConnection, "expressions", "selector", "TEXT NOT NULL DEFAULT '{}'")
+	if err != nil {
+		return err
+	}
+	err = addColumn(dbConnection, "users", "weight", "INTEGER NOT NULL DEFAULT 1")
+	if err != nil {
+		return err
+	}
+	err = addColumn(dbConnection, "tasks", "exact_args", "TEXT NOT NULL DEFAULT '[]'")
+	if err != nil {
+		return err
+	}
+	err = addColumn(dbConnection, "tasks", "exact_result", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	// Ключ идемпотентности уникален в пределах пользователя
+	_, err = dbConnection.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS expressions_idempotency_key
+		ON expressions (creator_id, idempotency_key) WHERE idempotency_key != ''`)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// addColumn добавляет столбец в таблицу, если его еще нет.
+func addColumn(dbConnection *sql.DB, table, column, definition string) error {
+	rows, err := dbConnection.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = dbConnection.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
+
 func NewDB(dataSourceName string) (*DB, error) {
 	dir := ""
 	if idx := len(dataSourceName) - 1; idx >= 0 {
@@ -165,6 +277,61 @@ func (db *DB) GetUserByUsername(username string) (UserPublic, error) {
 	return user, nil
 }
 
+// GetUserByID возвращает пользователя по идентификатору.
+// Если такого пользователя нет, возвращается пустой пользователь.
+func (db *DB) GetUserByID(id string) (UserPublic, error) {
+	row := db.dbConnection.QueryRow("SELECT id, username FROM users WHERE id = ?", id)
+
+	var user UserPublic
+	err := row.Scan(&user.ID, &user.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return UserPublic{}, nil
+		}
+		return UserPublic{}, err
+	}
+
+	return user, nil
+}
+
+// SetUserWeight задает вес пользователя в планировщике задач.
+// Возвращает ErrNotFound, если такого пользователя нет.
+func (db *DB) SetUserWeight(id string, weight int) error {
+	res, err := db.dbConnection.Exec("UPDATE users SET weight = ? WHERE id = ?", weight, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetUserWeights возвращает веса пользователей, отличные от веса по умолчанию.
+func (db *DB) GetUserWeights() (map[string]int, error) {
+	rows, err := db.dbConnection.Query("SELECT id, weight FROM users WHERE weight != 1")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	weights := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var weight int
+		if err := rows.Scan(&id, &weight); err != nil {
+			return nil, err
+		}
+		weights[id] = weight
+	}
+
+	return weights, rows.Err()
+}
+
 func (db *DB) GetUserAll() ([]UserPublic, error) {
 	rows, err := db.dbConnection.Query("SELECT id, username FROM users")
 	if err != nil {
@@ -211,8 +378,53 @@ func (db *DB) CreateExpression(creatorID string, form CalculateRequest) (Express
 }
 
 func (db *DB) CreateExpressionWithId(creatorID, expressionId string, form CalculateRequest) (ExpressionDB, error) {
-	_, err := db.dbConnection.Exec("INSERT INTO expressions (id, expression, status, result, creator_id) VALUES (?, ?, ?, ?, ?)",
-		expressionId, form.Expression, "running", 0, creatorID)
+	return insertExpression(db.dbConnection, creatorID, "", expressionId, form)
+}
+
+// CreateExpressionsBatch сохраняет пакет выражений в одной транзакции:
+// либо сохраняются все выражения, либо ни одного.
+func (db *DB) CreateExpressionsBatch(creatorID, batchID string, ids []string, forms []CalculateRequest) ([]ExpressionDB, error) {
+	tx, err := db.dbConnection.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	expressions := make([]ExpressionDB, 0, len(forms))
+	for i, form := range forms {
+		expression, err := insertExpression(tx, creatorID, batchID, ids[i], form)
+		if err != nil {
+			return nil, err
+		}
+		expressions = append(expressions, expression)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return expressions, nil
+}
+
+// execer выполняет запросы как *sql.DB, так и *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// insertExpression сохраняет новое вычисляемое выражение.
+func insertExpression(exec execer, creatorID, batchID, expressionId string, form CalculateRequest) (ExpressionDB, error) {
+	variables, err := json.Marshal(form.Variables)
+	if err != nil {
+		return ExpressionDB{}, err
+	}
+	selector, err := json.Marshal(form.Selector)
+	if err != nil {
+		return ExpressionDB{}, err
+	}
+	mode := form.Mode
+	if mode == "" {
+		mode = calc.ModeFloat
+	}
+	_, err = exec.Exec("INSERT INTO expressions (id, expression, status, result, creator_id, variables, mode, batch_id, label, idempotency_key, priority, selector) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		expressionId, form.Expression, "running", 0, creatorID, string(variables), mode, batchID, form.Label, form.IdempotencyKey, form.Priority, string(selector))
 	if err != nil {
 		return ExpressionDB{}, err
 	}
@@ -223,15 +435,47 @@ func (db *DB) CreateExpressionWithId(creatorID, expressionId string, form Calcul
 		Status:     "running",
 		Result:     0,
 		CreatorId:  creatorID,
+		Variables:  form.Variables,
+		Mode:       mode,
+		BatchID:    batchID,
+		Label:      form.Label,
+		Priority:   form.Priority,
+		Selector:   form.Selector,
 	}
 	return expression, nil
 }
 
-func (db *DB) GetExpressionByID(id string) (ExpressionDB, error) {
-	row := db.dbConnection.QueryRow("SELECT id, expression, status, result, creator_id FROM expressions WHERE id = ?", id)
+// expressionColumns перечисляет столбцы, которые читает scanExpression.
+const expressionColumns = "id, expression, status, result, creator_id, variables, mode, exact_result, batch_id, label, priority, selector"
 
+// scanExpression читает выражение из строки результата запроса.
+func scanExpression(row interface{ Scan(dest ...any) error }) (ExpressionDB, error) {
 	var expression ExpressionDB
-	err := row.Scan(&expression.ID, &expression.Expression, &expression.Status, &expression.Result, &expression.CreatorId)
+	var variables, selector sql.NullString
+	err := row.Scan(&expression.ID, &expression.Expression, &expression.Status, &expression.Result, &expression.CreatorId, &variables,
+		&expression.Mode, &expression.ExactResult, &expression.BatchID, &expression.Label, &expression.Priority, &selector)
+	if err != nil {
+		return ExpressionDB{}, err
+	}
+	if variables.Valid && variables.String != "" {
+		err = json.Unmarshal([]byte(variables.String), &expression.Variables)
+		if err != nil {
+			return ExpressionDB{}, err
+		}
+	}
+	if selector.Valid && selector.String != "" {
+		err = json.Unmarshal([]byte(selector.String), &expression.Selector)
+		if err != nil {
+			return ExpressionDB{}, err
+		}
+	}
+	return expression, nil
+}
+
+func (db *DB) GetExpressionByID(id string) (ExpressionDB, error) {
+	row := db.dbConnection.QueryRow("SELECT "+expressionColumns+" FROM expressions WHERE id = ?", id)
+
+	expression, err := scanExpression(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return ExpressionDB{}, nil
@@ -242,8 +486,24 @@ func (db *DB) GetExpressionByID(id string) (ExpressionDB, error) {
 	return expression, nil
 }
 
-func (db *DB) SetResultExpression(id, status string, result float64) error {
-	_, err := db.dbConnection.Exec("UPDATE expressions SET status = ?, result = ? WHERE id = ?", status, result, id)
+// GetExpressionByIdempotencyKey возвращает выражение пользователя, созданное с ключом
+// идемпотентности. Если такого выражения нет, возвращается пустое выражение.
+func (db *DB) GetExpressionByIdempotencyKey(creatorID, key string) (ExpressionDB, error) {
+	row := db.dbConnection.QueryRow("SELECT "+expressionColumns+" FROM expressions WHERE creator_id = ? AND idempotency_key = ?", creatorID, key)
+
+	expression, err := scanExpression(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ExpressionDB{}, nil
+		}
+		return ExpressionDB{}, err
+	}
+
+	return expression, nil
+}
+
+func (db *DB) SetResultExpression(id, status string, result float64, exactResult string) error {
+	_, err := db.dbConnection.Exec("UPDATE expressions SET status = ?, result = ?, exact_result = ? WHERE id = ?", status, result, exactResult, id)
 	if err != nil {
 		return err
 	}
@@ -251,7 +511,7 @@ func (db *DB) SetResultExpression(id, status string, result float64) error {
 }
 
 func (db *DB) GetAllExpressions() ([]ExpressionDB, error) {
-	rows, err := db.dbConnection.Query("SELECT id, expression, status, result, creator_id FROM expressions")
+	rows, err := db.dbConnection.Query("SELECT " + expressionColumns + " FROM expressions")
 	if err != nil {
 		return nil, err
 	}
@@ -259,8 +519,7 @@ func (db *DB) GetAllExpressions() ([]ExpressionDB, error) {
 
 	var expressions []ExpressionDB
 	for rows.Next() {
-		var expression ExpressionDB
-		err := rows.Scan(&expression.ID, &expression.Expression, &expression.Status, &expression.Result, &expression.CreatorId)
+		expression, err := scanExpression(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -270,8 +529,29 @@ func (db *DB) GetAllExpressions() ([]ExpressionDB, error) {
 	return expressions, nil
 }
 
+// GetAllExpressionsByUserID возвращает выражения пользователя в порядке создания.
 func (db *DB) GetAllExpressionsByUserID(userID string) ([]ExpressionDB, error) {
-	rows, err := db.dbConnection.Query("SELECT id, expression, status, result, creator_id FROM expressions WHERE creator_id = ?", userID)
+	rows, err := db.dbConnection.Query("SELECT "+expressionColumns+" FROM expressions WHERE creator_id = ? ORDER BY rowid", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expressions []ExpressionDB
+	for rows.Next() {
+		expression, err := scanExpression(rows)
+		if err != nil {
+			return nil, err
+		}
+		expressions = append(expressions, expression)
+	}
+
+	return expressions, nil
+}
+
+// GetExpressionsByBatchID возвращает выражения пакета в порядке их отправки.
+func (db *DB) GetExpressionsByBatchID(batchID string) ([]ExpressionDB, error) {
+	rows, err := db.dbConnection.Query("SELECT "+expressionColumns+" FROM expressions WHERE batch_id = ? ORDER BY rowid", batchID)
 	if err != nil {
 		return nil, err
 	}
@@ -279,8 +559,7 @@ func (db *DB) GetAllExpressionsByUserID(userID string) ([]ExpressionDB, error) {
 
 	var expressions []ExpressionDB
 	for rows.Next() {
-		var expression ExpressionDB
-		err := rows.Scan(&expression.ID, &expression.Expression, &expression.Status, &expression.Result, &expression.CreatorId)
+		expression, err := scanExpression(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -289,3 +568,81 @@ func (db *DB) GetAllExpressionsByUserID(userID string) ([]ExpressionDB, error) {
 
 	return expressions, nil
 }
+
+func (db *DB) CreateTask(expressionID string, node int, task Task) error {
+	return insertTask(db.dbConnection, expressionID, node, task)
+}
+
+// CreateTasks сохраняет новые задачи в одной транзакции.
+func (db *DB) CreateTasks(tasks []newTask) error {
+	tx, err := db.dbConnection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, task := range tasks {
+		if err := insertTask(tx, task.exprID, task.node, task.task); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insertTask сохраняет новую задачу в статусе pending.
+func insertTask(exec execer, expressionID string, node int, task Task) error {
+	args, err := json.Marshal(task.Args)
+	if err != nil {
+		return err
+	}
+	exactArgs, err := json.Marshal(task.ExactArgs)
+	if err != nil {
+		return err
+	}
+	_, err = exec.Exec("INSERT INTO tasks (id, expression_id, node, operation, arg1, arg2, args, exact_args, operation_time, status, result, attempts) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		task.ID, expressionID, node, task.Operation, task.Arg1, task.Arg2, string(args), string(exactArgs), task.OperationTime, TaskStatusPending, 0, 0)
+	return err
+}
+
+func (db *DB) SetTaskStatus(id, status string, attempts int) error {
+	_, err := db.dbConnection.Exec("UPDATE tasks SET status = ?, attempts = ? WHERE id = ?", status, attempts, id)
+	return err
+}
+
+func (db *DB) SetTaskResult(id string, result float64, exactResult string) error {
+	_, err := db.dbConnection.Exec("UPDATE tasks SET status = ?, result = ?, exact_result = ? WHERE id = ?", TaskStatusDone, result, exactResult, id)
+	return err
+}
+
+func (db *DB) GetTasksByExpressionID(expressionID string) ([]TaskDB, error) {
+	rows, err := db.dbConnection.Query("SELECT id, expression_id, node, operation, arg1, arg2, args, exact_args, operation_time, status, result, exact_result, attempts FROM tasks WHERE expression_id = ?", expressionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []TaskDB
+	for rows.Next() {
+		var task TaskDB
+		var args, exactArgs string
+		err := rows.Scan(&task.ID, &task.ExpressionID, &task.Node, &task.Operation, &task.Arg1, &task.Arg2, &args, &exactArgs,
+			&task.OperationTime, &task.Status, &task.Result, &task.ExactResult, &task.Attempts)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(args), &task.Args); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(exactArgs), &task.ExactArgs); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+func (db *DB) DeleteTasksByExpressionID(expressionID string) error {
+	_, err := db.dbConnection.Exec("DELETE FROM tasks WHERE expression_id = ?", expressionID)
+	return err
+}
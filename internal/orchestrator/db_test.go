@@ -1,7 +1,10 @@
 package orchestrator
 
 import (
+	"database/sql"
 	"testing"
+
+	"github.com/denis-gr/GOCACL_DISTRIBUTED/pkg/calc"
 )
 
 func TestCreateUser_Success(t *testing.T) {
@@ -266,6 +269,32 @@ func TestGetExpressionByID(t *testing.T) {
 	}
 }
 
+func TestGetExpressionByIDVariables(t *testing.T) {
+
+	db, err := NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	form := CalculateRequest{
+		Expression: "2+x",
+		Variables:  map[string]float64{"x": 2.5},
+	}
+	expression, err := db.CreateExpression("", form)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	retrievedExpression, err := db.GetExpressionByID(expression.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if retrievedExpression.Variables["x"] != 2.5 {
+		t.Errorf("expected variable x = 2.5, got %v", retrievedExpression.Variables)
+	}
+}
+
 func TestSetResultExpression(t *testing.T) {
 
 	db, err := NewDB(":memory:")
@@ -292,7 +321,7 @@ func TestSetResultExpression(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	err = db.SetResultExpression(expression.ID, "completed", 4.0)
+	err = db.SetResultExpression(expression.ID, "completed", 4.0, "4")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -308,6 +337,9 @@ func TestSetResultExpression(t *testing.T) {
 	if updatedExpression.Result != 4.0 {
 		t.Errorf("expected result 4.0, got %f", updatedExpression.Result)
 	}
+	if updatedExpression.ExactResult != "4" || updatedExpression.Mode != calc.ModeFloat {
+		t.Errorf("expected exact result 4 in float mode, got %q in %q", updatedExpression.ExactResult, updatedExpression.Mode)
+	}
 }
 
 func TestGetAllExpressions(t *testing.T) {
@@ -386,3 +418,125 @@ func TestGetAllExpressionsByUserID(t *testing.T) {
 		t.Errorf("expected %d expressions, got %d", len(expressions), len(userExpressions))
 	}
 }
+
+func TestTasks(t *testing.T) {
+
+	db, err := NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	task := Task{ID: "task-1", Arg1: 1, Arg2: 2, Args: []float64{1, 2, 3}, ExactArgs: []string{"1", "2", "3.0000000000000000001"}, Operation: "max", OperationTime: 100}
+	err = db.CreateTask("expr-1", 2, task)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = db.SetTaskStatus(task.ID, TaskStatusLeased, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tasks, err := db.GetTasksByExpressionID("expr-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tasks) != 1 {
+		t.Fatalf("expected 1 task, got %d", len(tasks))
+	}
+	if tasks[0].Node != 2 || tasks[0].Status != TaskStatusLeased || tasks[0].Attempts != 1 || len(tasks[0].Args) != 3 ||
+		len(tasks[0].ExactArgs) != 3 || tasks[0].ExactArgs[2] != "3.0000000000000000001" {
+		t.Errorf("unexpected task: %+v", tasks[0])
+	}
+
+	err = db.SetTaskResult(task.ID, 3, "3.0000000000000000001")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tasks, _ = db.GetTasksByExpressionID("expr-1")
+	if tasks[0].Status != TaskStatusDone || tasks[0].Result != 3 || tasks[0].ExactResult != "3.0000000000000000001" {
+		t.Errorf("unexpected task: %+v", tasks[0])
+	}
+
+	err = db.DeleteTasksByExpressionID("expr-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tasks, _ = db.GetTasksByExpressionID("expr-1")
+	if len(tasks) != 0 {
+		t.Errorf("expected no tasks, got %d", len(tasks))
+	}
+}
+
+func TestNewDBAddsMissingColumns(t *testing.T) {
+	path := t.TempDir() + "/db.sqlite3"
+	oldDB, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	_, err = oldDB.Exec(`CREATE TABLE expressions (
+        id TEXT PRIMARY KEY,
+        expression TEXT NOT NULL,
+        status TEXT NOT NULL,
+        result REAL,
+		creator_id TEXT NOT NULL
+    );`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	oldDB.Close()
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	expression, err := db.CreateExpression("user", CalculateRequest{Expression: "x", Variables: map[string]float64{"x": 1}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	retrievedExpression, err := db.GetExpressionByID(expression.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if retrievedExpression.Variables["x"] != 1 {
+		t.Errorf("expected variable x = 1, got %v", retrievedExpression.Variables)
+	}
+}
+
+func TestCreateExpressionsBatch(t *testing.T) {
+	db, err := NewDB(":memory:")
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	forms := []CalculateRequest{{Expression: "1+1", Label: "first"}, {Expression: "2+2"}}
+	_, err = db.CreateExpressionsBatch("user-1", "batch-1", []string{"expr-1", "expr-2"}, forms)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expressions, err := db.GetExpressionsByBatchID("batch-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(expressions) != 2 || expressions[0].ID != "expr-1" || expressions[0].Label != "first" ||
+		expressions[1].ID != "expr-2" || expressions[1].BatchID != "batch-1" {
+		t.Errorf("unexpected expressions: %+v", expressions)
+	}
+
+	// Повторный идентификатор откатывает всю транзакцию
+	_, err = db.CreateExpressionsBatch("user-1", "batch-2", []string{"expr-3", "expr-1"}, forms)
+	if err == nil {
+		t.Fatalf("expected an error for a duplicate id")
+	}
+	expressions, _ = db.GetExpressionsByBatchID("batch-2")
+	if len(expressions) != 0 {
+		t.Errorf("expected no expressions from the failed batch, got %d", len(expressions))
+	}
+	expression, _ := db.GetExpressionByID("expr-3")
+	if expression.ID != "" {
+		t.Errorf("expected expr-3 to be rolled back, got %+v", expression)
+	}
+}
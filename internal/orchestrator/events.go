@@ -0,0 +1,87 @@
+package orchestrator
+
+import "context"
+
+// Типы событий об изменении выражений
+const (
+	EventExpression    = "expression"     // Выражение создано или изменило статус
+	EventTaskLeased    = "task_leased"    // Задача выражения выдана агенту
+	EventTaskCompleted = "task_completed" // Агент вернул результат задачи выражения
+)
+
+// eventBuffer — число событий, которые подписчик может не успеть прочитать.
+// Если буфер заполнен, новые события для этого подписчика отбрасываются.
+const eventBuffer = 64
+
+// Event описывает изменение выражения или одной из его задач.
+type Event struct {
+	Type       string     `json:"type"`
+	Expression Expression `json:"expression"`
+	TaskID     string     `json:"task_id,omitempty"`
+}
+
+// subscriber получает события о выражениях пользователя.
+type subscriber struct {
+	userID string
+	exprID string // Пустой, если нужны события обо всех выражениях пользователя
+	events chan Event
+}
+
+// Subscribe подписывается на события о выражениях пользователя userID.
+// Если exprID не пустой, приходят только события об этом выражении.
+// Возвращает канал событий и функцию отмены подписки, которую нужно вызвать
+// после завершения чтения.
+func (f *DistributedCalculator) Subscribe(userID, exprID string) (<-chan Event, func()) {
+	sub := &subscriber{
+		userID: userID,
+		exprID: exprID,
+		events: make(chan Event, eventBuffer),
+	}
+	f.mu.Lock()
+	f.subscribers[sub] = struct{}{}
+	f.mu.Unlock()
+	return sub.events, func() {
+		f.mu.Lock()
+		delete(f.subscribers, sub)
+		f.mu.Unlock()
+	}
+}
+
+// publish рассылает событие о выражении подписчикам. Не блокируется,
+// если подписчик не успевает читать события. Вызывается с захваченным f.mu.
+func (f *DistributedCalculator) publish(eventType, exprID, taskID string) {
+	expr, ok := f.expressions[exprID]
+	if !ok {
+		return
+	}
+	event := Event{Type: eventType, Expression: expr, TaskID: taskID}
+	for sub := range f.subscribers {
+		if sub.userID != expr.CreatorID || (sub.exprID != "" && sub.exprID != exprID) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+}
+
+// WaitExpression возвращает выражение пользователя, дождавшись, пока оно
+// перестанет вычисляться, или отмены ctx. Ожидание построено на подписке на
+// события, поэтому результат возвращается сразу после его получения.
+// Для чужих и несуществующих выражений возвращается ErrNotFound.
+func (f *DistributedCalculator) WaitExpression(ctx context.Context, id, userID string) (ExpressionResponse, error) {
+	events, unsubscribe := f.Subscribe(userID, id)
+	defer unsubscribe()
+	for {
+		res, err := f.GetUserExpressionByID(id, userID)
+		if err != nil || res.Expression.Status != "running" {
+			return res, err
+		}
+		select {
+		case <-ctx.Done():
+			return res, nil
+		case <-events:
+		}
+	}
+}
@@ -4,9 +4,12 @@ package orchestrator
 import (
 	"errors"
 	"log"
+	"math"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/denis-gr/GOCACL_DISTRIBUTED/pkg/calc"
 
@@ -16,31 +19,136 @@ import (
 // ErrNotFound используется для обозначения ошибки, когда элемент не найден.
 var ErrNotFound = errors.New("")
 
+// ErrNotRunning возвращается при попытке отменить уже завершенное выражение.
+var ErrNotRunning = errors.New("expression is not running")
+
+// ErrCancelled используется как статус отмененного выражения.
+var ErrCancelled = errors.New("cancelled")
+
+// Допустимые приоритеты выражений. Задачи выражений с большим приоритетом
+// выдаются агентам раньше, задачи с одинаковым приоритетом — в порядке создания.
+const (
+	MinPriority = -10
+	MaxPriority = 10
+)
+
+// ErrInvalidPriority возвращается, если приоритет выходит за допустимые пределы.
+var ErrInvalidPriority = errors.New("priority must be between -10 and 10")
+
+// MaxTasksPerRequest — наибольшее число задач, которое агент получает за один запрос.
+const MaxTasksPerRequest = 100
+
+// ErrInvalidSelector возвращается, если в селекторе меток выражения есть пустое имя метки.
+var ErrInvalidSelector = errors.New("selector label names must not be empty")
+
 // DistributedCalculator представляет распределенный вычислитель.
 type DistributedCalculator struct {
 	expressions map[string]Expression
 	tasks       map[string]Task
-	taskBusy    map[string]bool
-	resultChans map[string]chan float64
+	queue       *taskQueue    // Очередь невыданных задач по приоритету
+	tasksReady  chan struct{} // Закрывается, когда в очереди появляются задачи
+	taskLeases  map[string]time.Time
+	taskTries   map[string]int
+	taskNodes   map[string]taskRef
+	taskAgents  map[string]string    // Агенты, которым выданы задачи
+	agents      map[string]*Agent    // Живые агенты по идентификаторам
+	withdrawn   map[string]time.Time // Снятые задачи, результаты которых еще могут прийти, и до какого времени их ждать
+	evaluations map[string]*evaluation
+	subscribers map[*subscriber]struct{}
+	submissions map[string][]time.Time // Время запросов на вычисление за последнюю минуту по пользователям
+	admitting   map[string]int         // Число запускаемых, но еще не зарегистрированных выражений по пользователям
+	routedAt    time.Time              // Когда последний раз искались задачи, которые не может выполнить ни один агент
+	newTasks    []newTask              // Задачи, созданные при запуске пакета и еще не сохраненные в базе данных, nil вне CalculateBatch
 	mu          sync.Mutex
 	db          *DB
 }
 
+// taskRef связывает задачу с вершиной графа выражения, которую она вычисляет.
+type taskRef struct {
+	exprID string
+	node   int
+}
+
+// newTask — задача, которая сохраняется в базе данных вместе с другими задачами пакета.
+type newTask struct {
+	exprID string
+	node   int
+	task   Task
+}
+
+// evaluation хранит состояние вычисления одного выражения.
+type evaluation struct {
+	graph   *calc.Graph
+	mode    string
+	values  []float64
+	exact   []string            // Значения вершин без потери точности, заполняются только в точных режимах
+	waiting []int               // Число ещё не вычисленных операндов каждой вершины
+	parents [][]int             // Вершины, которые используют значение данной вершины
+	tasks   map[string]struct{} // Опубликованные и еще не выполненные задачи выражения
+}
+
+func newEvaluation(graph *calc.Graph, mode string) *evaluation {
+	ev := &evaluation{
+		graph:   graph,
+		mode:    mode,
+		values:  make([]float64, len(graph.Nodes)),
+		exact:   make([]string, len(graph.Nodes)),
+		waiting: make([]int, len(graph.Nodes)),
+		parents: make([][]int, len(graph.Nodes)),
+		tasks:   make(map[string]struct{}),
+	}
+	for i, node := range graph.Nodes {
+		ev.waiting[i] = len(node.Args)
+		for _, arg := range node.Args {
+			ev.parents[arg] = append(ev.parents[arg], i)
+		}
+	}
+	return ev
+}
+
+// setValue сохраняет значение вершины. В точном режиме приоритет имеет точное
+// значение, а если его нет, например, от старого агента, оно восстанавливается из float64.
+func (ev *evaluation) setValue(node int, value float64, exact string) {
+	ev.values[node] = value
+	if !calc.IsExactMode(ev.mode) {
+		return
+	}
+	x, err := calc.ParseExact(exact)
+	if err != nil {
+		x, err = calc.ExactFromFloat(value)
+		if err != nil {
+			return
+		}
+	}
+	ev.values[node] = calc.ExactToFloat(x)
+	ev.exact[node] = calc.FormatExact(x, ev.mode)
+}
+
 // NewDistributedCalculator создает новый экземпляр DistributedCalculator.
 func NewDistributedCalculator(db *DB) *DistributedCalculator {
-	return &DistributedCalculator{
+	f := &DistributedCalculator{
 		expressions: make(map[string]Expression),
 		tasks:       make(map[string]Task),
-		taskBusy:    make(map[string]bool),
-		resultChans: make(map[string]chan float64),
+		queue:       newTaskQueue(),
+		tasksReady:  make(chan struct{}),
+		taskLeases:  make(map[string]time.Time),
+		taskTries:   make(map[string]int),
+		taskNodes:   make(map[string]taskRef),
+		taskAgents:  make(map[string]string),
+		agents:      make(map[string]*Agent),
+		withdrawn:   make(map[string]time.Time),
+		evaluations: make(map[string]*evaluation),
+		subscribers: make(map[*subscriber]struct{}),
+		submissions: make(map[string][]time.Time),
+		admitting:   make(map[string]int),
 		db:          db,
 	}
+	go f.watchAgents()
+	return f
 }
 
-func (f *DistributedCalculator) createNewTask(a, b float64, ops string) float64 {
-	id, _ := uuid.NewV7()
-	idStr := id.String()
-
+// operationTime возвращает время выполнения операции в миллисекундах.
+func operationTime(ops string) int64 {
 	var operationTime string
 	switch ops {
 	case "+":
@@ -51,29 +159,184 @@ func (f *DistributedCalculator) createNewTask(a, b float64, ops string) float64
 		operationTime = os.Getenv("TIME_MULTIPLICATIONS_MS")
 	case "/":
 		operationTime = os.Getenv("TIME_DIVISIONS_MS")
+	case "%":
+		operationTime = os.Getenv("TIME_MODULO_MS")
+	case "^":
+		operationTime = os.Getenv("TIME_EXPONENTIATION_MS")
+	case "~":
+		operationTime = os.Getenv("TIME_NEGATION_MS")
+	default:
+		// Время выполнения функции задается переменной TIME_<ИМЯ>_MS,
+		// например TIME_SQRT_MS, иначе используется TIME_FUNCTIONS_MS
+		operationTime = os.Getenv("TIME_" + strings.ToUpper(ops) + "_MS")
+		if operationTime == "" {
+			operationTime = os.Getenv("TIME_FUNCTIONS_MS")
+		}
 	}
 	operationTimeInt, _ := strconv.ParseInt(operationTime, 10, 64)
+	return operationTimeInt
+}
 
-	resultChan := make(chan float64)
-	f.mu.Lock()
-	f.tasks[idStr] = Task{
-		ID:            idStr,
-		Arg1:          a,
-		Arg2:          b,
-		Operation:     ops,
-		OperationTime: operationTimeInt,
-	}
-	f.resultChans[idStr] = resultChan
-	f.mu.Unlock()
-	result := <-resultChan
-	return result
+// leaseDuration возвращает время, на которое задача выдается агенту.
+// Если за это время результат не получен, задача возвращается в очередь.
+func leaseDuration(task Task) time.Duration {
+	grace, err := strconv.ParseInt(os.Getenv("TASK_LEASE_GRACE_MS"), 10, 64)
+	if err != nil {
+		grace = 5000
+	}
+	return time.Duration(task.OperationTime+grace) * time.Millisecond
+}
+
+// releaseExpiredLeases возвращает в очередь задачи, срок аренды которых истек
+// или агенты которых перестали сообщать, что живы, и забывает снятые задачи,
+// результатов которых больше не ждут. Вызывается с захваченным f.mu.
+func (f *DistributedCalculator) releaseExpiredLeases(now time.Time) {
+	for id, deadline := range f.withdrawn {
+		if now.After(deadline) {
+			delete(f.withdrawn, id)
+		}
+	}
+	f.releaseDeadAgents(now)
+	f.failUnroutableTasks(now)
+	for id, deadline := range f.taskLeases {
+		if now.After(deadline) {
+			f.releaseLease(id)
+			log.Printf("Lease of task %s expired, returning it to the queue", id)
+		}
+	}
+}
+
+// releaseLease возвращает выданную задачу в очередь. Вызывается с захваченным f.mu.
+func (f *DistributedCalculator) releaseLease(id string) {
+	delete(f.taskLeases, id)
+	delete(f.taskAgents, id)
+	f.queue.requeue(id)
+	f.notifyTasks()
+	if err := f.db.SetTaskStatus(id, TaskStatusPending, f.taskTries[id]); err != nil {
+		log.Println(err)
+	}
 }
 
-func (f *DistributedCalculator) saveResult(exprID string, res float64, err error) {
+// TasksReady возвращает канал, который закроется, когда в очереди появятся
+// новые задачи. Канал нужно получать до попытки взять задачу, чтобы не пропустить
+// задачи, появившиеся между попыткой и ожиданием.
+func (f *DistributedCalculator) TasksReady() <-chan struct{} {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	expr, exists := f.expressions[exprID]
+	return f.tasksReady
+}
 
+// notifyTasks будит всех, кто ждет задач. Вызывается с захваченным f.mu.
+func (f *DistributedCalculator) notifyTasks() {
+	close(f.tasksReady)
+	f.tasksReady = make(chan struct{})
+}
+
+// completeNode сохраняет значение вершины и публикует задачи для всех вершин,
+// операнды которых стали известны. Вызывается с захваченным f.mu.
+func (f *DistributedCalculator) completeNode(exprID string, ev *evaluation, node int, value float64, exact string) {
+	ev.setValue(node, value, exact)
+	if node == ev.graph.Root {
+		f.saveResult(exprID, ev.values[node], ev.exact[node], nil)
+		return
+	}
+	for _, parent := range ev.parents[node] {
+		ev.waiting[parent]--
+		if ev.waiting[parent] == 0 {
+			f.createNewTask(exprID, ev, parent, nil)
+		}
+		if f.evaluations[exprID] != ev {
+			return
+		}
+	}
+}
+
+// createNewTask публикует задачу для вершины, все операнды которой уже вычислены.
+// Если задача для вершины была сохранена до перезапуска, она публикуется повторно
+// с прежним идентификатором. Вызывается с захваченным f.mu.
+func (f *DistributedCalculator) createNewTask(exprID string, ev *evaluation, node int, saved *TaskDB) {
+	graphNode := ev.graph.Nodes[node]
+	args := make([]float64, len(graphNode.Args))
+	for i, arg := range graphNode.Args {
+		args[i] = ev.values[arg]
+	}
+	task := Task{
+		Args:          args,
+		Operation:     graphNode.Operation,
+		OperationTime: operationTime(graphNode.Operation),
+		Priority:      f.expressions[exprID].Priority,
+		Selector:      f.expressions[exprID].Selector,
+	}
+	if len(args) > 0 {
+		task.Arg1 = args[0]
+	}
+	if len(args) > 1 {
+		task.Arg2 = args[1]
+	}
+	isZero := task.Arg2 == 0
+	if calc.IsExactMode(ev.mode) {
+		task.Mode = ev.mode
+		task.ExactArgs = make([]string, len(graphNode.Args))
+		for i, arg := range graphNode.Args {
+			task.ExactArgs[i] = ev.exact[arg]
+		}
+		if len(task.ExactArgs) > 1 {
+			x, err := calc.ParseExact(task.ExactArgs[1])
+			isZero = err == nil && x.Sign() == 0
+		}
+	}
+	if (task.Operation == "/" || task.Operation == "%") && isZero {
+		f.saveResult(exprID, 0, "", calc.ErrDivisionByZero)
+		return
+	}
+
+	var err error
+	if saved != nil {
+		task.ID = saved.ID
+		f.taskTries[task.ID] = saved.Attempts
+		err = f.db.SetTaskStatus(task.ID, TaskStatusPending, saved.Attempts)
+	} else {
+		id, _ := uuid.NewV7()
+		task.ID = id.String()
+		if f.newTasks != nil {
+			f.newTasks = append(f.newTasks, newTask{exprID: exprID, node: node, task: task})
+		} else {
+			err = f.db.CreateTask(exprID, node, task)
+		}
+	}
+	if err != nil {
+		log.Println(err)
+	}
+	f.tasks[task.ID] = task
+	f.taskNodes[task.ID] = taskRef{exprID: exprID, node: node}
+	ev.tasks[task.ID] = struct{}{}
+	f.queue.add(task, f.expressions[exprID].CreatorID)
+	f.notifyTasks()
+}
+
+// saveResult завершает вычисление выражения и снимает его оставшиеся задачи.
+// Результаты снятых задач, уже выданных агентам, принимаются и отбрасываются.
+// Вызывается с захваченным f.mu.
+func (f *DistributedCalculator) saveResult(exprID string, res float64, exact string, err error) {
+	if ev, ok := f.evaluations[exprID]; ok {
+		for taskID := range ev.tasks {
+			if deadline, ok := f.taskLeases[taskID]; ok {
+				f.withdrawn[taskID] = deadline
+			}
+			delete(f.tasks, taskID)
+			f.queue.remove(taskID)
+			delete(f.taskLeases, taskID)
+			delete(f.taskAgents, taskID)
+			delete(f.taskTries, taskID)
+			delete(f.taskNodes, taskID)
+		}
+	}
+	delete(f.evaluations, exprID)
+	if dbErr := f.db.DeleteTasksByExpressionID(exprID); dbErr != nil {
+		log.Println(dbErr)
+	}
+
+	expr, exists := f.expressions[exprID]
 	if !exists {
 		return
 	}
@@ -82,86 +345,228 @@ func (f *DistributedCalculator) saveResult(exprID string, res float64, err error
 	} else {
 		expr.Status = "ok"
 		expr.Result = res
+		expr.ExactResult = exact
 	}
 	f.expressions[exprID] = expr
-	err = db.SetResultExpression(exprID, expr.Status, res)
+	err = f.db.SetResultExpression(exprID, expr.Status, res, expr.ExactResult)
 	if err != nil {
 		log.Println(err)
 	}
+	f.publish(EventExpression, exprID, "")
 }
 
-func (f *DistributedCalculator) calculate(id, expression string) (CalculateResponse, error) {
-	f.mu.Lock()
-	f.expressions[id] = Expression{
-		ID:     id,
-		Status: "running",
-		Result: 0,
-	}
-	f.mu.Unlock()
+// parse строит граф зависимостей выражения из запроса. В functions передаются
+// функции, которые можно вызывать в выражении.
+// Возвращает *calc.ParseError, если выражение некорректно.
+func parse(req CalculateRequest, functions map[string]calc.Function) (*calc.Graph, error) {
+	ops := calc.NewOperationsDefault()
+	ops.Variables = req.Variables
+	ops.Functions = functions
+	ops.Exact = calc.IsExactMode(req.Mode)
+	return ops.Graph(req.Expression)
+}
 
-	ops := calc.Operations{
-		PlusFunc: func(a, b float64) float64 {
-			return calculator.createNewTask(a, b, "+")
-		},
-		MinusFunc: func(a, b float64) float64 {
-			return calculator.createNewTask(a, b, "-")
-		},
-		MultiplyFunc: func(a, b float64) float64 {
-			return calculator.createNewTask(a, b, "*")
-		},
-		DivideFunc: func(a, b float64) float64 {
-			if b == 0 {
-				panic("деление на ноль")
-			}
-			return calculator.createNewTask(a, b, "/")
-		},
+// prepare проверяет режим вычисления, приоритет и селектор меток и строит граф
+// выражения из запроса. Пустой режим в запросе заменяется режимом по умолчанию.
+func prepare(req *CalculateRequest, functions map[string]calc.Function) (*calc.Graph, error) {
+	if req.Priority < MinPriority || req.Priority > MaxPriority {
+		return nil, ErrInvalidPriority
+	}
+	if _, ok := req.Selector[""]; ok {
+		return nil, ErrInvalidSelector
 	}
+	mode, err := calc.ParseMode(req.Mode)
+	if err != nil {
+		return nil, err
+	}
+	req.Mode = mode
+	return parse(*req, functions)
+}
 
-	resultChan := make(chan struct {
-		res float64
-		err error
-	})
+// calculate запускает вычисление выражения по его графу. В expr передаются
+// идентификатор, режим, приоритет и создатель выражения. В savedTasks передаются
+// задачи, сохраненные в базе данных до перезапуска: уже вычисленные вершины не
+// пересчитываются, а невыполненные задачи публикуются повторно.
+func (f *DistributedCalculator) calculate(expr Expression, graph *calc.Graph, savedTasks []TaskDB) (CalculateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.start(expr, graph, savedTasks)
+	return CalculateResponse{ID: expr.ID}, nil
+}
 
-	go func() {
-		ans, err := ops.Calc(expression)
-		resultChan <- struct {
-			res float64
-			err error
-		}{res: ans, err: err}
-	}()
+// start регистрирует вычисление выражения и публикует задачи, операнды которых
+// уже известны. Вызывается с захваченным f.mu.
+func (f *DistributedCalculator) start(expr Expression, graph *calc.Graph, savedTasks []TaskDB) {
+	id := expr.ID
+	expr.Status = "running"
+	expr.Result = 0
+	f.expressions[id] = expr
+	f.publish(EventExpression, id, "")
 
-	go func() {
-		result := <-resultChan
-		f.saveResult(id, result.res, result.err)
-	}()
+	ev := newEvaluation(graph, expr.Mode)
+	f.evaluations[id] = ev
+	known := make([]bool, len(graph.Nodes))
+	saved := make(map[int]*TaskDB)
+	for i := range savedTasks {
+		task := &savedTasks[i]
+		if task.Node < 0 || task.Node >= len(graph.Nodes) {
+			continue
+		}
+		if task.Status == TaskStatusDone {
+			ev.setValue(task.Node, task.Result, task.ExactResult)
+			known[task.Node] = true
+		} else {
+			saved[task.Node] = task
+		}
+	}
+	for i, node := range graph.Nodes {
+		if node.Operation == "" {
+			ev.setValue(i, node.Value, node.Exact)
+			known[i] = true
+		}
+		if known[i] {
+			for _, parent := range ev.parents[i] {
+				ev.waiting[parent]--
+			}
+		}
+	}
+	if known[graph.Root] {
+		f.saveResult(id, ev.values[graph.Root], ev.exact[graph.Root], nil)
+		return
+	}
 
-	return CalculateResponse{ID: id}, nil
+	// Задачи для всех вершин, операнды которых уже известны, публикуются
+	// одновременно и могут выполняться разными агентами параллельно.
+	for i := range graph.Nodes {
+		if known[i] || ev.waiting[i] > 0 {
+			continue
+		}
+		f.createNewTask(id, ev, i, saved[i])
+		if f.evaluations[id] != ev {
+			break
+		}
+	}
 }
 
 // Calculate выполняет логику для обработки запроса на добавление вычисления арифметического выражения.
-func (f *DistributedCalculator) Calculate(req CalculateRequest) (CalculateResponse, error) {
+// Синтаксически некорректное выражение не сохраняется, а возвращается *calc.ParseError.
+// Если задан ключ идемпотентности и пользователь уже создал выражение с этим ключом,
+// возвращается идентификатор этого выражения, а новое вычисление не запускается.
+// Для неизвестного режима вычисления возвращается calc.ErrUnknownMode,
+// для недопустимого приоритета — ErrInvalidPriority, для пустого имени метки в
+// селекторе — ErrInvalidSelector, а при превышении ограничений
+// пользователя — *QuotaError.
+func (f *DistributedCalculator) Calculate(creatorID string, req CalculateRequest) (CalculateResponse, error) {
+	graph, err := prepare(&req, f.functions())
+	if err != nil {
+		return CalculateResponse{}, err
+	}
+	if req.IdempotencyKey != "" {
+		if res, ok := f.findIdempotent(creatorID, req.IdempotencyKey); ok {
+			return res, nil
+		}
+	}
+	if err := checkOperations(graph); err != nil {
+		return CalculateResponse{}, err
+	}
+	if err := f.admit(creatorID, 1); err != nil {
+		return CalculateResponse{}, err
+	}
+	defer f.release(creatorID, 1)
 	id, _ := uuid.NewV7()
 	idStr := id.String()
-	return f.calculate(idStr, req.Expression)
+	_, err = f.db.CreateExpressionWithId(creatorID, idStr, req)
+	if err != nil {
+		// Одновременный запрос с тем же ключом мог успеть создать выражение первым
+		if res, ok := f.findIdempotent(creatorID, req.IdempotencyKey); ok && req.IdempotencyKey != "" {
+			return res, nil
+		}
+		return CalculateResponse{}, err
+	}
+	return f.calculate(Expression{ID: idStr, Mode: req.Mode, Priority: req.Priority, Selector: req.Selector, CreatorID: creatorID, Label: req.Label}, graph, nil)
+}
+
+// findIdempotent ищет выражение, уже созданное пользователем с ключом идемпотентности.
+func (f *DistributedCalculator) findIdempotent(creatorID, key string) (CalculateResponse, bool) {
+	expr, err := f.db.GetExpressionByIdempotencyKey(creatorID, key)
+	if err != nil {
+		log.Println(err)
+		return CalculateResponse{}, false
+	}
+	if expr.ID == "" {
+		return CalculateResponse{}, false
+	}
+	return CalculateResponse{ID: expr.ID}, true
 }
 
 // LoadFromDB загружает данные из базы данных.
+// Завершенные выражения загружаются как есть, а незавершенные продолжают
+// вычисляться с того места, на котором остановились.
 func (f *DistributedCalculator) LoadFromDB() {
+	weights, err := f.db.GetUserWeights()
+	if err != nil {
+		panic(err)
+	}
+	f.mu.Lock()
+	for userID, weight := range weights {
+		f.queue.setWeight(userID, weight)
+	}
+	f.mu.Unlock()
 	expressions, err := f.db.GetAllExpressions()
 	if err != nil {
 		panic(err)
 	}
+	functions := calc.DefaultFunctions()
 	for _, expr := range expressions {
-		f.calculate(expr.ID, expr.Expression)
+		if expr.Status != "running" {
+			f.mu.Lock()
+			f.expressions[expr.ID] = expressionFromDB(expr)
+			f.mu.Unlock()
+			continue
+		}
+		addSavedFunctions(functions, expr.Expression)
+		graph, err := parse(CalculateRequest{Expression: expr.Expression, Mode: expr.Mode, Variables: expr.Variables}, functions)
+		if err != nil {
+			f.mu.Lock()
+			f.expressions[expr.ID] = expressionFromDB(expr)
+			f.saveResult(expr.ID, 0, "", err)
+			f.mu.Unlock()
+			continue
+		}
+		tasks, err := f.db.GetTasksByExpressionID(expr.ID)
+		if err != nil {
+			panic(err)
+		}
+		f.calculate(expressionFromDB(expr), graph, tasks)
+	}
+}
+
+// expressionFromDB преобразует выражение из базы данных в представление для ответа.
+func expressionFromDB(expr ExpressionDB) Expression {
+	return Expression{
+		ID:          expr.ID,
+		Status:      expr.Status,
+		Result:      expr.Result,
+		Mode:        expr.Mode,
+		ExactResult: expr.ExactResult,
+		BatchID:     expr.BatchID,
+		Label:       expr.Label,
+		Priority:    expr.Priority,
+		Selector:    expr.Selector,
+		CreatorID:   expr.CreatorId,
 	}
 }
 
 // GetExpressions выполняет логику для обработки запроса на получение списка выражений.
+// Возвращает только выражения API v0, то есть без создателя.
 func (f *DistributedCalculator) GetExpressions() (ExpressionsResponse, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	expressions := []Expression{}
 	for _, v := range f.expressions {
+		if v.CreatorID != "" {
+			continue
+		}
 		expressions = append(expressions, v)
 	}
 	return ExpressionsResponse{Expressions: expressions}, nil
@@ -180,47 +585,227 @@ func (f *DistributedCalculator) GetExpressionByID(id string) (ExpressionResponse
 	}, nil
 }
 
-// GetTask выполняет логику для обработки запроса на получение задачи для выполнения.
+// GetExpressionsByUserID возвращает выражения, созданные пользователем, в порядке создания.
+func (f *DistributedCalculator) GetExpressionsByUserID(userID string) (ExpressionsResponse, error) {
+	saved, err := f.db.GetAllExpressionsByUserID(userID)
+	if err != nil {
+		return ExpressionsResponse{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	expressions := []Expression{}
+	for _, v := range saved {
+		// Состояние в памяти актуальнее, чем в базе данных
+		expr, ok := f.expressions[v.ID]
+		if !ok {
+			expr = expressionFromDB(v)
+		}
+		expressions = append(expressions, expr)
+	}
+	return ExpressionsResponse{Expressions: expressions}, nil
+}
+
+// GetUserExpressionByID возвращает выражение по его идентификатору, если его создал пользователь.
+// Для выражений других пользователей возвращается ErrNotFound.
+func (f *DistributedCalculator) GetUserExpressionByID(id, userID string) (ExpressionResponse, error) {
+	res, err := f.GetExpressionByID(id)
+	if err != nil {
+		return ExpressionResponse{}, err
+	}
+	if res.Expression.CreatorID != userID {
+		return ExpressionResponse{}, ErrNotFound
+	}
+	return res, nil
+}
+
+// CancelExpression отменяет вычисление выражения: снимает его задачи
+// и устанавливает статус "cancelled". Возвращает ErrNotFound, если выражения нет,
+// и ErrNotRunning, если оно уже завершено.
+func (f *DistributedCalculator) CancelExpression(id string) (ExpressionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	expr, ok := f.expressions[id]
+	if !ok {
+		return ExpressionResponse{}, ErrNotFound
+	}
+	if _, running := f.evaluations[id]; !running || expr.Status != "running" {
+		return ExpressionResponse{Expression: expr}, ErrNotRunning
+	}
+	f.saveResult(id, 0, "", ErrCancelled)
+	log.Printf("Expression %s cancelled", id)
+	return ExpressionResponse{Expression: f.expressions[id]}, nil
+}
+
+// GetTask выполняет логику для обработки запроса на получение задачи для выполнения
+// агентом, который не зарегистрирован.
 func (f *DistributedCalculator) GetTask() (TaskResponse, error) {
+	return f.GetTaskForAgent("")
+}
+
+// GetTaskForAgent выдает задачу агенту agentID. Зарегистрированный агент получает
+// только задачи, которые он может выполнить (см. canRun), и его задача возвращается
+// в очередь сразу, как только агент перестанет сообщать, что жив.
+// Задачи распределяются между пользователями пропорционально их весам. Из задач
+// пользователя первой выдается задача с наибольшим приоритетом, при равных
+// приоритетах — самая ранняя.
+func (f *DistributedCalculator) GetTaskForAgent(agentID string) (TaskResponse, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	for id, task := range f.tasks {
-		_, ok := f.taskBusy[id]
+	now := time.Now()
+	f.releaseExpiredLeases(now)
+	f.touchAgent(agentID, now)
+	task, ok := f.leaseTask(agentID, now)
+	if !ok {
+		return TaskResponse{}, ErrNotFound
+	}
+	return TaskResponse{Task: task}, nil
+}
+
+// GetTasksForAgent выдает агенту agentID до count задач в том же порядке, что и
+// GetTaskForAgent. Если задач нет, возвращается пустой список. count ограничивается
+// значением MaxTasksPerRequest.
+func (f *DistributedCalculator) GetTasksForAgent(agentID string, count int) ([]Task, error) {
+	if count < 1 {
+		count = 1
+	}
+	if count > MaxTasksPerRequest {
+		count = MaxTasksPerRequest
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	f.releaseExpiredLeases(now)
+	f.touchAgent(agentID, now)
+	tasks := []Task{}
+	for len(tasks) < count {
+		task, ok := f.leaseTask(agentID, now)
 		if !ok {
-			f.taskBusy[id] = true
-			return TaskResponse{Task: task}, nil
+			break
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// touchAgent отмечает, что зарегистрированный агент жив. Вызывается с захваченным f.mu.
+func (f *DistributedCalculator) touchAgent(agentID string, now time.Time) {
+	if agent, ok := f.agents[agentID]; ok {
+		agent.LastSeen = now
+	}
+}
+
+// leaseTask извлекает следующую задачу, которую может выполнить агент agentID,
+// и выдает ее агенту. Возвращает false, если подходящих задач нет.
+// Вызывается с захваченным f.mu.
+func (f *DistributedCalculator) leaseTask(agentID string, now time.Time) (Task, bool) {
+	agent := f.agents[agentID]
+	var match func(id string) bool
+	if f.needsMatch(agent) {
+		match = func(id string) bool {
+			return canRun(agent, f.tasks[id])
 		}
 	}
-	return TaskResponse{}, ErrNotFound
+	id, ok := f.queue.pop(match)
+	if !ok {
+		return Task{}, false
+	}
+	task := f.tasks[id]
+	f.taskLeases[id] = now.Add(leaseDuration(task))
+	if agent != nil {
+		f.taskAgents[id] = agentID
+	}
+	f.taskTries[id]++
+	if err := f.db.SetTaskStatus(id, TaskStatusLeased, f.taskTries[id]); err != nil {
+		log.Println(err)
+	}
+	f.publish(EventTaskLeased, f.taskNodes[id].exprID, id)
+	return task, true
 }
 
 // GetTasks выполняет логику для обработки запроса на получение всех задач.
 func (f *DistributedCalculator) GetTasks() (TaskFullResponse, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
+	f.releaseExpiredLeases(time.Now())
 	tasks := []TaskFull{}
 	for id, task := range f.tasks {
-		_, isBusy := f.taskBusy[id]
+		_, isBusy := f.taskLeases[id]
 		tasks = append(tasks, TaskFull{
 			ID:            task.ID,
 			Arg1:          task.Arg1,
 			Arg2:          task.Arg2,
+			Args:          task.Args,
 			Operation:     task.Operation,
 			OperationTime: task.OperationTime,
+			Mode:          task.Mode,
+			ExactArgs:     task.ExactArgs,
+			Priority:      task.Priority,
+			Selector:      task.Selector,
 			IsBusy:        isBusy,
+			Attempts:      f.taskTries[id],
 		})
 	}
 	return TaskFullResponse{TasksFull: tasks}, nil
 }
 
+// validResult проверяет, что агент вернул конечное число и разборчивое точное значение.
+func validResult(req TaskResultRequest) bool {
+	if math.IsNaN(req.Result) || math.IsInf(req.Result, 0) {
+		return false
+	}
+	if req.ExactResult != "" {
+		if _, err := calc.ParseExact(req.ExactResult); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
 // PostTaskResult выполняет логику для обработки запроса на прием результата обработки данных.
+// Если агент сообщил об ошибке, выражение завершается с этой ошибкой. Результат,
+// который не является конечным числом (NaN, бесконечность или неразборчивое точное
+// значение), считается ошибкой invalid_number.
 func (f *DistributedCalculator) PostTaskResult(req TaskResultRequest) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	c, ok := f.resultChans[req.ID]
+	ref, ok := f.taskNodes[req.ID]
 	if !ok {
+		if _, ok := f.withdrawn[req.ID]; ok {
+			// Выражение уже завершено или отменено, поздний результат не нужен
+			delete(f.withdrawn, req.ID)
+			return nil
+		}
 		return ErrNotFound
 	}
-	c <- req.Result
+	delete(f.tasks, req.ID)
+	f.queue.remove(req.ID)
+	delete(f.taskLeases, req.ID)
+	delete(f.taskAgents, req.ID)
+	delete(f.taskTries, req.ID)
+	delete(f.taskNodes, req.ID)
+
+	ev, ok := f.evaluations[ref.exprID]
+	if !ok {
+		return nil
+	}
+	delete(ev.tasks, req.ID)
+	f.publish(EventTaskCompleted, ref.exprID, req.ID)
+	if req.ErrorCode == "" && req.ErrorMessage == "" && !validResult(req) {
+		req.ErrorCode = calc.ErrCodeInvalidNumber
+		req.ErrorMessage = calc.ErrInvalidNumber.Error()
+	}
+	if req.ErrorCode != "" || req.ErrorMessage != "" {
+		message := req.ErrorMessage
+		if message == "" {
+			message = req.ErrorCode
+		}
+		log.Printf("Task %s failed: %s", req.ID, message)
+		f.saveResult(ref.exprID, 0, "", errors.New(message))
+		return nil
+	}
+	if err := f.db.SetTaskResult(req.ID, req.Result, req.ExactResult); err != nil {
+		log.Println(err)
+	}
+	f.completeNode(ref.exprID, ev, ref.node, req.Result, req.ExactResult)
 	return nil
 }
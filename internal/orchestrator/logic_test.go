@@ -0,0 +1,1048 @@
+package orchestrator
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/denis-gr/GOCACL_DISTRIBUTED/internal/gen"
+	"github.com/denis-gr/GOCACL_DISTRIBUTED/pkg/calc"
+)
+
+func TestCalculateParallelTasks(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	res, _ := c.Calculate("", CalculateRequest{Expression: "(1+2)*(3+4)"})
+
+	tasks, _ := c.GetTasks()
+	if len(tasks.TasksFull) != 2 {
+		t.Fatalf("expected 2 independent tasks, got %d", len(tasks.TasksFull))
+	}
+	for _, task := range tasks.TasksFull {
+		if task.Operation != "+" {
+			t.Errorf("expected operation +, got %s", task.Operation)
+		}
+		err := c.PostTaskResult(TaskResultRequest{ID: task.ID, Result: task.Arg1 + task.Arg2})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	task, err := c.GetTask()
+	if err != nil {
+		t.Fatalf("expected the dependent task, got %v", err)
+	}
+	if task.Task.Operation != "*" || task.Task.Arg1 != 3 || task.Task.Arg2 != 7 {
+		t.Errorf("unexpected task: %+v", task.Task)
+	}
+	err = c.PostTaskResult(TaskResultRequest{ID: task.Task.ID, Result: 21})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expr, _ := c.GetExpressionByID(res.ID)
+	if expr.Expression.Status != "ok" || expr.Expression.Result != 21 {
+		t.Errorf("unexpected expression: %+v", expr.Expression)
+	}
+}
+
+func TestCalculateDivisionByZero(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	res, _ := c.Calculate("", CalculateRequest{Expression: "(1+2)+8/0"})
+
+	expr, _ := c.GetExpressionByID(res.ID)
+	if expr.Expression.Status != "деление на ноль" {
+		t.Errorf("expected division by zero, got %q", expr.Expression.Status)
+	}
+	tasks, _ := c.GetTasks()
+	if len(tasks.TasksFull) != 0 {
+		t.Errorf("expected no tasks left, got %d", len(tasks.TasksFull))
+	}
+}
+
+func TestTaskLeaseExpires(t *testing.T) {
+	t.Setenv("TASK_LEASE_GRACE_MS", "0")
+	c := NewDistributedCalculator(db)
+	c.Calculate("", CalculateRequest{Expression: "2+2"})
+
+	first, err := c.GetTask()
+	if err != nil {
+		t.Fatalf("expected a task, got %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	second, err := c.GetTask()
+	if err != nil {
+		t.Fatalf("expected the expired task to be re-queued, got %v", err)
+	}
+	if second.Task.ID != first.Task.ID {
+		t.Errorf("expected task %s, got %s", first.Task.ID, second.Task.ID)
+	}
+
+	tasks, _ := c.GetTasks()
+	if len(tasks.TasksFull) != 1 || tasks.TasksFull[0].Attempts != 2 {
+		t.Errorf("expected one task with 2 attempts, got %+v", tasks.TasksFull)
+	}
+}
+
+func TestTaskLeaseActive(t *testing.T) {
+	t.Setenv("TASK_LEASE_GRACE_MS", "60000")
+	c := NewDistributedCalculator(db)
+	c.Calculate("", CalculateRequest{Expression: "2+2"})
+
+	if _, err := c.GetTask(); err != nil {
+		t.Fatalf("expected a task, got %v", err)
+	}
+	if _, err := c.GetTask(); err != ErrNotFound {
+		t.Errorf("expected leased task to stay busy, got %v", err)
+	}
+}
+
+func TestLoadFromDBResumesExpression(t *testing.T) {
+	testDB, err := NewDB(t.TempDir() + "/db.sqlite3")
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	defer testDB.Close()
+
+	c := NewDistributedCalculator(testDB)
+	done, _ := c.Calculate("", CalculateRequest{Expression: "2"})
+	res, _ := c.Calculate("", CalculateRequest{Expression: "(1+2)*(3+4)"})
+
+	tasks, _ := c.GetTasks()
+	if len(tasks.TasksFull) != 2 {
+		t.Fatalf("expected 2 tasks, got %d", len(tasks.TasksFull))
+	}
+	finished := tasks.TasksFull[0]
+	err = c.PostTaskResult(TaskResultRequest{ID: finished.ID, Result: finished.Arg1 + finished.Arg2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	leased, _ := c.GetTask()
+
+	// Перезапуск: новый вычислитель поверх той же базы данных
+	restarted := NewDistributedCalculator(testDB)
+	restarted.LoadFromDB()
+
+	expr, err := restarted.GetExpressionByID(done.ID)
+	if err != nil || expr.Expression.Status != "ok" || expr.Expression.Result != 2 {
+		t.Errorf("expected finished expression to be loaded as is, got %+v, %v", expr.Expression, err)
+	}
+
+	tasks, _ = restarted.GetTasks()
+	if len(tasks.TasksFull) != 1 {
+		t.Fatalf("expected 1 unfinished task, got %d", len(tasks.TasksFull))
+	}
+	if tasks.TasksFull[0].ID != leased.Task.ID || tasks.TasksFull[0].IsBusy || tasks.TasksFull[0].Attempts != 1 {
+		t.Errorf("expected leased task %s to be re-queued, got %+v", leased.Task.ID, tasks.TasksFull[0])
+	}
+
+	err = restarted.PostTaskResult(TaskResultRequest{ID: leased.Task.ID, Result: leased.Task.Arg1 + leased.Task.Arg2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	task, err := restarted.GetTask()
+	if err != nil {
+		t.Fatalf("expected the dependent task, got %v", err)
+	}
+	if task.Task.Operation != "*" || task.Task.Arg1*task.Task.Arg2 != 21 {
+		t.Errorf("unexpected task: %+v", task.Task)
+	}
+	restarted.PostTaskResult(TaskResultRequest{ID: task.Task.ID, Result: 21})
+
+	stored, _ := testDB.GetExpressionByID(res.ID)
+	if stored.Status != "ok" || stored.Result != 21 {
+		t.Errorf("unexpected stored expression: %+v", stored)
+	}
+	saved, _ := testDB.GetTasksByExpressionID(res.ID)
+	if len(saved) != 0 {
+		t.Errorf("expected tasks of finished expression to be removed, got %d", len(saved))
+	}
+}
+
+func TestCalculateUnaryAndPower(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	res, _ := c.Calculate("", CalculateRequest{Expression: "-2^2%3"})
+
+	for _, want := range []string{"^", "~", "%"} {
+		task, err := c.GetTask()
+		if err != nil {
+			t.Fatalf("expected task %s, got %v", want, err)
+		}
+		if task.Task.Operation != want {
+			t.Fatalf("expected operation %s, got %s", want, task.Task.Operation)
+		}
+		var result float64
+		switch want {
+		case "^":
+			result = 4
+		case "~":
+			result = -task.Task.Arg1
+		case "%":
+			result = -1
+		}
+		c.PostTaskResult(TaskResultRequest{ID: task.Task.ID, Result: result})
+	}
+
+	expr, _ := c.GetExpressionByID(res.ID)
+	if expr.Expression.Status != "ok" || expr.Expression.Result != -1 {
+		t.Errorf("unexpected expression: %+v", expr.Expression)
+	}
+}
+
+func TestCalculateFunctionCall(t *testing.T) {
+	t.Setenv("TIME_FUNCTIONS_MS", "300")
+	t.Setenv("TIME_MAX_MS", "100")
+	c := NewDistributedCalculator(db)
+	res, _ := c.Calculate("", CalculateRequest{Expression: "max(1, 2+3, sqrt(9))"})
+
+	tasks, _ := c.GetTasks()
+	if len(tasks.TasksFull) != 2 {
+		t.Fatalf("expected 2 independent tasks, got %d", len(tasks.TasksFull))
+	}
+	for _, task := range tasks.TasksFull {
+		var result float64
+		switch task.Operation {
+		case "+":
+			result = 5
+		case "sqrt":
+			if task.OperationTime != 300 {
+				t.Errorf("expected operation time 300, got %d", task.OperationTime)
+			}
+			result = 3
+		default:
+			t.Fatalf("unexpected operation %s", task.Operation)
+		}
+		c.PostTaskResult(TaskResultRequest{ID: task.ID, Result: result})
+	}
+
+	task, err := c.GetTask()
+	if err != nil {
+		t.Fatalf("expected the max task, got %v", err)
+	}
+	if task.Task.Operation != "max" || len(task.Task.Args) != 3 || task.Task.OperationTime != 100 {
+		t.Fatalf("unexpected task: %+v", task.Task)
+	}
+	if task.Task.Args[0] != 1 || task.Task.Args[1] != 5 || task.Task.Args[2] != 3 {
+		t.Errorf("unexpected args: %v", task.Task.Args)
+	}
+	c.PostTaskResult(TaskResultRequest{ID: task.Task.ID, Result: 5})
+
+	expr, _ := c.GetExpressionByID(res.ID)
+	if expr.Expression.Status != "ok" || expr.Expression.Result != 5 {
+		t.Errorf("unexpected expression: %+v", expr.Expression)
+	}
+}
+
+func TestCalculateVariables(t *testing.T) {
+	testDB, err := NewDB(t.TempDir() + "/db.sqlite3")
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	defer testDB.Close()
+
+	c := NewDistributedCalculator(testDB)
+	res, _ := c.Calculate("", CalculateRequest{Expression: "x*rate", Variables: map[string]float64{"x": 2.5, "rate": 4}})
+	_, err = c.Calculate("", CalculateRequest{Expression: "x*y", Variables: map[string]float64{"x": 2.5}})
+
+	var parseErr *calc.ParseError
+	if !errors.As(err, &parseErr) || parseErr.Code != calc.ErrCodeUnknownVariable || parseErr.Token != "y" {
+		t.Errorf("expected unknown variable error, got %v", err)
+	}
+
+	// После перезапуска переменные берутся из базы данных
+	restarted := NewDistributedCalculator(testDB)
+	restarted.LoadFromDB()
+	task, err := restarted.GetTask()
+	if err != nil {
+		t.Fatalf("expected a task, got %v", err)
+	}
+	if task.Task.Arg1 != 2.5 || task.Task.Arg2 != 4 {
+		t.Errorf("unexpected task: %+v", task.Task)
+	}
+	restarted.PostTaskResult(TaskResultRequest{ID: task.Task.ID, Result: 10})
+
+	expr, _ := restarted.GetExpressionByID(res.ID)
+	if expr.Expression.Status != "ok" || expr.Expression.Result != 10 {
+		t.Errorf("unexpected expression: %+v", expr.Expression)
+	}
+}
+
+func TestCalculateDecimalMode(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	res, err := c.Calculate("", CalculateRequest{Expression: "(0.1+0.2)*12345678901234567890", Mode: calc.ModeDecimal})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	task, err := c.GetTask()
+	if err != nil {
+		t.Fatalf("expected a task, got %v", err)
+	}
+	if task.Task.Mode != calc.ModeDecimal || len(task.Task.ExactArgs) != 2 ||
+		task.Task.ExactArgs[0] != "0.1" || task.Task.ExactArgs[1] != "0.2" {
+		t.Fatalf("unexpected task: %+v", task.Task)
+	}
+	err = c.PostTaskResult(TaskResultRequest{ID: task.Task.ID, Result: 0.3, ExactResult: "0.3"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	task, _ = c.GetTask()
+	if task.Task.ExactArgs[0] != "0.3" || task.Task.ExactArgs[1] != "12345678901234567890" {
+		t.Fatalf("unexpected task: %+v", task.Task)
+	}
+	exact, _ := calc.ExactOperation(task.Task.Mode, task.Task.Operation, task.Task.ExactArgs)
+	err = c.PostTaskResult(TaskResultRequest{ID: task.Task.ID, ExactResult: exact})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expr, _ := c.GetExpressionByID(res.ID)
+	if expr.Expression.Status != "ok" || expr.Expression.ExactResult != "3703703670370370367" ||
+		expr.Expression.Result != 3703703670370370367 || expr.Expression.Mode != calc.ModeDecimal {
+		t.Errorf("unexpected expression: %+v", expr.Expression)
+	}
+
+	// Числа вне диапазона float64 допустимы в точном режиме
+	huge := "1" + strings.Repeat("0", 400)
+	res, err = c.Calculate("", CalculateRequest{Expression: huge + "+" + huge, Mode: calc.ModeDecimal})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	task, _ = c.GetTask()
+	if task.Task.ExactArgs[0] != huge || task.Task.ExactArgs[1] != huge || task.Task.Arg1 != math.MaxFloat64 {
+		t.Fatalf("unexpected task: %+v", task.Task)
+	}
+	exact, _ = calc.ExactOperation(task.Task.Mode, task.Task.Operation, task.Task.ExactArgs)
+	c.PostTaskResult(TaskResultRequest{ID: task.Task.ID, Result: math.MaxFloat64, ExactResult: exact})
+	if expr, _ := c.GetExpressionByID(res.ID); expr.Expression.Status != "ok" || expr.Expression.ExactResult != "2"+strings.Repeat("0", 400) {
+		t.Errorf("unexpected expression: %+v", expr.Expression)
+	}
+	_, err = c.Calculate("", CalculateRequest{Expression: huge})
+	var parseErr *calc.ParseError
+	if !errors.As(err, &parseErr) || parseErr.Code != calc.ErrCodeInvalidNumber {
+		t.Errorf("expected %s in float mode, got %v", calc.ErrCodeInvalidNumber, err)
+	}
+
+	_, err = c.Calculate("", CalculateRequest{Expression: "1+1", Mode: "binary"})
+	if !errors.Is(err, calc.ErrUnknownMode) {
+		t.Errorf("expected ErrUnknownMode, got %v", err)
+	}
+}
+
+func TestCalculateRationalMode(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	res, err := c.Calculate("", CalculateRequest{Expression: "1/3*3+22/7", Mode: calc.ModeRational})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Агент вычисляет задачи, пока выражение не будет вычислено
+	for {
+		task, err := c.GetTask()
+		if err != nil {
+			break
+		}
+		exact, err := calc.ExactOperation(task.Task.Mode, task.Task.Operation, task.Task.ExactArgs)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		c.PostTaskResult(TaskResultRequest{ID: task.Task.ID, ExactResult: exact})
+	}
+
+	expr, _ := c.GetExpressionByID(res.ID)
+	if expr.Expression.Status != "ok" || expr.Expression.ExactResult != "29/7" ||
+		expr.Expression.Result != 29.0/7 || expr.Expression.Mode != calc.ModeRational {
+		t.Errorf("unexpected expression: %+v", expr.Expression)
+	}
+}
+
+func TestPostTaskResultError(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	res, _ := c.Calculate("", CalculateRequest{Expression: "(1+2)*(3+4)"})
+
+	task, err := c.GetTask()
+	if err != nil {
+		t.Fatalf("expected a task, got %v", err)
+	}
+	err = c.PostTaskResult(TaskResultRequest{ID: task.Task.ID, ErrorCode: calc.ErrCodeUnsupportedOperation, ErrorMessage: "неподдерживаемая операция \"+\""})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expr, _ := c.GetExpressionByID(res.ID)
+	if expr.Expression.Status != "неподдерживаемая операция \"+\"" || expr.Expression.Result != 0 {
+		t.Errorf("unexpected expression: %+v", expr.Expression)
+	}
+	tasks, _ := c.GetTasks()
+	if len(tasks.TasksFull) != 0 {
+		t.Errorf("expected no tasks left, got %d", len(tasks.TasksFull))
+	}
+}
+
+func TestPostTaskResultNotFinite(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	for _, result := range []TaskResultRequest{{Result: math.NaN()}, {Result: math.Inf(1)}, {ExactResult: "abc"}} {
+		res, _ := c.Calculate("", CalculateRequest{Expression: "1+1"})
+		task, err := c.GetTask()
+		if err != nil {
+			t.Fatalf("expected a task, got %v", err)
+		}
+		result.ID = task.Task.ID
+		if err := c.PostTaskResult(result); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expr, _ := c.GetExpressionByID(res.ID)
+		if expr.Expression.Status != calc.ErrInvalidNumber.Error() || expr.Expression.Result != 0 {
+			t.Errorf("expected %v to fail the expression, got %+v", result, expr.Expression)
+		}
+	}
+}
+
+func TestCancelExpressionKeepsOtherTasks(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	cancelled, _ := c.Calculate("", CalculateRequest{Expression: "(1+2)*(3+4)"})
+	other, _ := c.Calculate("", CalculateRequest{Expression: "5+6"})
+
+	c.CancelExpression(cancelled.ID)
+	tasks, _ := c.GetTasks()
+	if len(tasks.TasksFull) != 1 || c.taskNodes[tasks.TasksFull[0].ID].exprID != other.ID {
+		t.Fatalf("expected only the task of %s, got %+v", other.ID, tasks.TasksFull)
+	}
+	if len(c.taskNodes) != 1 || len(c.evaluations[other.ID].tasks) != 1 {
+		t.Errorf("expected one indexed task, got %d and %d", len(c.taskNodes), len(c.evaluations[other.ID].tasks))
+	}
+}
+
+func TestCancelExpression(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	res, _ := c.Calculate("", CalculateRequest{Expression: "(1+2)*(3+4)"})
+
+	leased, err := c.GetTask()
+	if err != nil {
+		t.Fatalf("expected a task, got %v", err)
+	}
+
+	expr, err := c.CancelExpression(res.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expr.Expression.Status != "cancelled" {
+		t.Errorf("expected status cancelled, got %q", expr.Expression.Status)
+	}
+	tasks, _ := c.GetTasks()
+	if len(tasks.TasksFull) != 0 {
+		t.Errorf("expected no tasks left, got %d", len(tasks.TasksFull))
+	}
+	saved, _ := db.GetTasksByExpressionID(res.ID)
+	if len(saved) != 0 {
+		t.Errorf("expected no saved tasks left, got %d", len(saved))
+	}
+
+	// Поздний результат снятой задачи принимается, но ни на что не влияет
+	err = c.PostTaskResult(TaskResultRequest{ID: leased.Task.ID, Result: 3})
+	if err != nil {
+		t.Errorf("expected late result to be ignored, got %v", err)
+	}
+	err = c.PostTaskResult(TaskResultRequest{ID: leased.Task.ID, Result: 3})
+	if err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for a repeated late result, got %v", err)
+	}
+	got, _ := c.GetExpressionByID(res.ID)
+	if got.Expression.Status != "cancelled" {
+		t.Errorf("expected status cancelled, got %q", got.Expression.Status)
+	}
+
+	if _, err := c.CancelExpression(res.ID); err != ErrNotRunning {
+		t.Errorf("expected ErrNotRunning, got %v", err)
+	}
+	if _, err := c.CancelExpression("unknown"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	all, unsubscribeAll := c.Subscribe("subscriber", "")
+	defer unsubscribeAll()
+
+	first, _ := c.Calculate("subscriber", CalculateRequest{Expression: "1+1"})
+	c.Calculate("someone-else", CalculateRequest{Expression: "2+2"})
+	one, unsubscribeOne := c.Subscribe("subscriber", first.ID)
+	second, _ := c.Calculate("subscriber", CalculateRequest{Expression: "3+3"})
+
+	expected := []string{first.ID, second.ID}
+	for _, id := range expected {
+		event := <-all
+		if event.Type != EventExpression || event.Expression.ID != id || event.Expression.Status != "running" {
+			t.Errorf("unexpected event: %+v", event)
+		}
+	}
+
+	_, err := c.CancelExpression(first.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	event := <-one
+	if event.Expression.ID != first.ID || event.Expression.Status != "cancelled" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	if len(one) != 0 {
+		t.Errorf("expected no events about other expressions, got %d", len(one))
+	}
+
+	unsubscribeOne()
+	c.CancelExpression(second.ID)
+	if event := <-all; event.Expression.ID != first.ID {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	if event := <-all; event.Expression.ID != second.ID {
+		t.Errorf("unexpected event: %+v", event)
+	}
+}
+
+func TestCalculateBatch(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	res, err := c.CalculateBatch("batch-user", []CalculateRequest{
+		{Expression: "1+1", Label: "a"},
+		{Expression: "2*3", Label: "b"},
+		{Expression: "5"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.IDs) != 3 || res.BatchID == "" {
+		t.Fatalf("unexpected response: %+v", res)
+	}
+
+	batch, err := c.GetBatch(res.BatchID, "batch-user")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if batch.Total != 3 || batch.Running != 2 || batch.Done != 1 || batch.Failed != 0 {
+		t.Errorf("unexpected progress: %+v", batch)
+	}
+	for i, expr := range batch.Expressions {
+		if expr.ID != res.IDs[i] || expr.BatchID != res.BatchID {
+			t.Errorf("unexpected expression %d: %+v", i, expr)
+		}
+	}
+	if batch.Expressions[1].Label != "b" {
+		t.Errorf("expected label b, got %q", batch.Expressions[1].Label)
+	}
+
+	c.CancelExpression(res.IDs[0])
+	batch, _ = c.GetBatch(res.BatchID, "batch-user")
+	if batch.Running != 1 || batch.Failed != 1 {
+		t.Errorf("unexpected progress: %+v", batch)
+	}
+	if _, err := c.GetBatch(res.BatchID, "someone-else"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	// Некорректное выражение отклоняет весь пакет
+	_, err = c.CalculateBatch("batch-user", []CalculateRequest{{Expression: "1+1"}, {Expression: "2+"}})
+	var itemErr *BatchItemError
+	if !errors.As(err, &itemErr) || itemErr.Index != 1 {
+		t.Fatalf("expected BatchItemError for item 1, got %v", err)
+	}
+	var parseErr *calc.ParseError
+	if !errors.As(err, &parseErr) || parseErr.Code != calc.ErrCodeUnexpectedEnd {
+		t.Errorf("expected unexpected_end, got %v", err)
+	}
+	if _, err := c.CalculateBatch("batch-user", nil); err != ErrEmptyBatch {
+		t.Errorf("expected ErrEmptyBatch, got %v", err)
+	}
+	t.Setenv("BATCH_MAX_SIZE", "1")
+	if _, err := c.CalculateBatch("batch-user", make([]CalculateRequest, 2)); err != ErrBatchTooLarge {
+		t.Errorf("expected ErrBatchTooLarge, got %v", err)
+	}
+}
+
+func TestCalculateBatchTasks(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	res, err := c.CalculateBatch("batch-tasks-user", []CalculateRequest{
+		{Expression: "(1+2)*(3+4)"},
+		{Expression: "(1+1)+2/0"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Первые задачи пакета сохранены, а задачи завершившегося выражения — нет
+	if saved, _ := db.GetTasksByExpressionID(res.IDs[0]); len(saved) != 2 {
+		t.Errorf("expected 2 saved tasks, got %d", len(saved))
+	}
+	if saved, _ := db.GetTasksByExpressionID(res.IDs[1]); len(saved) != 0 {
+		t.Errorf("expected no saved tasks, got %d", len(saved))
+	}
+	tasks, _ := c.GetTasks()
+	if len(tasks.TasksFull) != 2 {
+		t.Errorf("expected 2 queued tasks, got %d", len(tasks.TasksFull))
+	}
+	if expr, _ := c.GetExpressionByID(res.IDs[1]); expr.Expression.Status != calc.ErrDivisionByZero.Error() {
+		t.Errorf("unexpected expression: %+v", expr.Expression)
+	}
+}
+
+func TestCalculateBatchRateLimit(t *testing.T) {
+	t.Setenv("QUOTA_SUBMISSIONS_PER_MINUTE", "3")
+	c := NewDistributedCalculator(db)
+	batch := []CalculateRequest{{Expression: "1+1"}, {Expression: "2+2"}}
+	if _, err := c.CalculateBatch("batch-rate-user", batch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Каждое выражение пакета считается отдельным запросом
+	var quotaErr *QuotaError
+	_, err := c.CalculateBatch("batch-rate-user", batch)
+	if !errors.As(err, &quotaErr) || quotaErr.Limit != LimitSubmissionsPerMinute || quotaErr.RetryAfter <= 0 {
+		t.Fatalf("expected %s quota error, got %v", LimitSubmissionsPerMinute, err)
+	}
+	_, err = c.CalculateBatch("another-batch-rate-user", append(batch, batch...))
+	if !errors.As(err, &quotaErr) || quotaErr.Limit != LimitSubmissionsPerMinute || quotaErr.RetryAfter != 0 {
+		t.Errorf("expected a batch larger than the quota to be rejected without retry, got %v", err)
+	}
+	if usage, _ := c.GetUsage("batch-rate-user"); usage.SubmissionsLastMinute != 2 {
+		t.Errorf("expected 2 submissions, got %+v", usage)
+	}
+}
+
+func TestCalculateIdempotencyKey(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	// База данных тестов сохраняется между запусками, поэтому ключ уникален
+	req := CalculateRequest{Expression: "2+2", IdempotencyKey: "key-" + time.Now().Format(time.RFC3339Nano)}
+	first, err := c.Calculate("idempotent-user", req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := c.Calculate("idempotent-user", req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("expected repeated request to return %s, got %s", first.ID, second.ID)
+	}
+	if len(c.tasks) != 1 {
+		t.Errorf("expected 1 task, got %d", len(c.tasks))
+	}
+
+	// Ключ уникален только в пределах пользователя
+	other, err := c.Calculate("another-user", req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if other.ID == first.ID {
+		t.Errorf("expected a new expression for another user")
+	}
+	// Без ключа каждый запрос создает новое выражение
+	third, _ := c.Calculate("idempotent-user", CalculateRequest{Expression: "2+2"})
+	fourth, _ := c.Calculate("idempotent-user", CalculateRequest{Expression: "2+2"})
+	if third.ID == fourth.ID {
+		t.Errorf("expected different expressions without a key")
+	}
+}
+
+func TestGetTaskPriority(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	low, _ := c.Calculate("", CalculateRequest{Expression: "1+1", Priority: -1})
+	first, _ := c.Calculate("", CalculateRequest{Expression: "2+2"})
+	high, _ := c.Calculate("", CalculateRequest{Expression: "3+3", Priority: 5})
+	second, _ := c.Calculate("", CalculateRequest{Expression: "4+4"})
+
+	// Сначала больший приоритет, внутри одного приоритета — в порядке создания
+	for _, want := range []string{high.ID, first.ID, second.ID, low.ID} {
+		res, err := c.GetTask()
+		if err != nil {
+			t.Fatalf("expected a task, got %v", err)
+		}
+		if got := c.taskNodes[res.Task.ID].exprID; got != want {
+			t.Errorf("expected a task of expression %s, got %s", want, got)
+		}
+		if want == high.ID && res.Task.Priority != 5 {
+			t.Errorf("expected task priority 5, got %d", res.Task.Priority)
+		}
+	}
+	if _, err := c.GetTask(); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	if _, err := c.Calculate("", CalculateRequest{Expression: "1+1", Priority: MaxPriority + 1}); err != ErrInvalidPriority {
+		t.Errorf("expected ErrInvalidPriority, got %v", err)
+	}
+}
+
+func TestGetTaskPriorityAfterLeaseExpires(t *testing.T) {
+	t.Setenv("TASK_LEASE_GRACE_MS", "0")
+	c := NewDistributedCalculator(db)
+	first, _ := c.Calculate("", CalculateRequest{Expression: "1+1"})
+	leased, _ := c.GetTask()
+	c.Calculate("", CalculateRequest{Expression: "2+2"})
+	time.Sleep(5 * time.Millisecond)
+
+	// Задача с истекшей арендой возвращается на прежнее место в очереди
+	res, err := c.GetTask()
+	if err != nil {
+		t.Fatalf("expected a task, got %v", err)
+	}
+	if res.Task.ID != leased.Task.ID || c.taskNodes[res.Task.ID].exprID != first.ID {
+		t.Errorf("expected the expired task %s first, got %s", leased.Task.ID, res.Task.ID)
+	}
+}
+
+func TestGetTaskFairShare(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	for i := 0; i < 4; i++ {
+		c.Calculate("fair-a", CalculateRequest{Expression: "1+1"})
+	}
+	for i := 0; i < 2; i++ {
+		c.Calculate("fair-b", CalculateRequest{Expression: "1+1"})
+	}
+
+	// Пользователь с большим пакетом не задерживает задачи другого пользователя
+	var order []string
+	for i := 0; i < 6; i++ {
+		res, err := c.GetTask()
+		if err != nil {
+			t.Fatalf("expected a task, got %v", err)
+		}
+		order = append(order, c.expressions[c.taskNodes[res.Task.ID].exprID].CreatorID)
+	}
+	want := []string{"fair-a", "fair-b", "fair-a", "fair-b", "fair-a", "fair-a"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("unexpected dispatch order %v; want %v", order, want)
+		}
+	}
+}
+
+func TestGetTaskWeightedShare(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	c.queue.setWeight("weighted-b", 2)
+	for i := 0; i < 6; i++ {
+		c.Calculate("weighted-a", CalculateRequest{Expression: "1+1"})
+		c.Calculate("weighted-b", CalculateRequest{Expression: "1+1"})
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 6; i++ {
+		res, _ := c.GetTask()
+		counts[c.expressions[c.taskNodes[res.Task.ID].exprID].CreatorID]++
+	}
+	if counts["weighted-a"] != 2 || counts["weighted-b"] != 4 {
+		t.Errorf("expected 2 and 4 tasks, got %v", counts)
+	}
+
+	scheduler, err := c.GetScheduler()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, user := range scheduler.Users {
+		if user.UserID == "weighted-b" && (user.Weight != 2 || user.Queued != 2 || user.Leased != 4 || user.Dispatched != 4) {
+			t.Errorf("unexpected scheduler state: %+v", user)
+		}
+	}
+
+	if err := c.SetUserWeight("weighted-b", 0); err != ErrInvalidWeight {
+		t.Errorf("expected ErrInvalidWeight, got %v", err)
+	}
+	if err := c.SetUserWeight("no-such-user", 2); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestCalculateQuotas(t *testing.T) {
+	t.Setenv("QUOTA_RUNNING_EXPRESSIONS", "2")
+	t.Setenv("QUOTA_OPERATIONS_PER_EXPRESSION", "2")
+	c := NewDistributedCalculator(db)
+
+	var quotaErr *QuotaError
+	_, err := c.Calculate("quota-user", CalculateRequest{Expression: "1+2*3-4"})
+	if !errors.As(err, &quotaErr) || quotaErr.Limit != LimitOperationsPerExpression || quotaErr.RetryAfter != 0 {
+		t.Fatalf("expected %s quota error, got %v", LimitOperationsPerExpression, err)
+	}
+
+	first, _ := c.Calculate("quota-user", CalculateRequest{Expression: "1+1"})
+	c.Calculate("quota-user", CalculateRequest{Expression: "2+2"})
+	_, err = c.Calculate("quota-user", CalculateRequest{Expression: "3+3"})
+	if !errors.As(err, &quotaErr) || quotaErr.Limit != LimitRunningExpressions || quotaErr.RetryAfter <= 0 {
+		t.Fatalf("expected %s quota error, got %v", LimitRunningExpressions, err)
+	}
+	// Ограничения одного пользователя не касаются других и API v0
+	if _, err := c.Calculate("other-quota-user", CalculateRequest{Expression: "3+3"}); err != nil {
+		t.Errorf("unexpected error for another user: %v", err)
+	}
+	if _, err := c.Calculate("", CalculateRequest{Expression: "3+3"}); err != nil {
+		t.Errorf("unexpected error for API v0: %v", err)
+	}
+	// API v0 подчиняется тем же ограничениям как один анонимный пользователь
+	if _, err := c.Calculate("", CalculateRequest{Expression: "1+2*3-4"}); !errors.As(err, &quotaErr) || quotaErr.Limit != LimitOperationsPerExpression {
+		t.Errorf("expected %s quota error for API v0, got %v", LimitOperationsPerExpression, err)
+	}
+
+	_, err = c.CalculateBatch("other-quota-user", []CalculateRequest{{Expression: "1"}, {Expression: "2"}, {Expression: "3"}})
+	if !errors.As(err, &quotaErr) || quotaErr.Limit != LimitRunningExpressions || quotaErr.RetryAfter != 0 {
+		t.Errorf("expected a batch larger than the quota to be rejected without retry, got %v", err)
+	}
+
+	c.CancelExpression(first.ID)
+	if _, err := c.Calculate("quota-user", CalculateRequest{Expression: "3+3"}); err != nil {
+		t.Errorf("expected a slot after cancellation, got %v", err)
+	}
+
+	usage, _ := c.GetUsage("quota-user")
+	if usage.RunningExpressions != 2 || usage.RunningExpressionsLimit != 2 || usage.SubmissionsLastMinute != 3 ||
+		usage.OperationsPerExpressionLimit != 2 || usage.SubmissionsPerMinuteLimit != 0 {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestCalculateRateLimit(t *testing.T) {
+	t.Setenv("QUOTA_SUBMISSIONS_PER_MINUTE", "2")
+	c := NewDistributedCalculator(db)
+	for i := 0; i < 2; i++ {
+		if _, err := c.Calculate("rate-user", CalculateRequest{Expression: "1+1"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	var quotaErr *QuotaError
+	_, err := c.Calculate("rate-user", CalculateRequest{Expression: "1+1"})
+	if !errors.As(err, &quotaErr) || quotaErr.Limit != LimitSubmissionsPerMinute ||
+		quotaErr.RetryAfter <= 0 || quotaErr.RetryAfter > time.Minute {
+		t.Fatalf("expected %s quota error, got %v", LimitSubmissionsPerMinute, err)
+	}
+
+	// Запросы старше минуты не учитываются
+	c.submissions["rate-user"][0] = time.Now().Add(-time.Minute)
+	if _, err := c.Calculate("rate-user", CalculateRequest{Expression: "1+1"}); err != nil {
+		t.Errorf("expected the oldest submission to expire, got %v", err)
+	}
+}
+
+func TestGetTasksForAgent(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	c.Calculate("", CalculateRequest{Expression: "(1+2)*(3+4)+(5+6)"})
+
+	tasks, err := c.GetTasksForAgent("", 2)
+	if err != nil || len(tasks) != 2 {
+		t.Fatalf("expected 2 tasks, got %+v, %v", tasks, err)
+	}
+	tasks, err = c.GetTasksForAgent("", 5)
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("expected the last ready task, got %+v, %v", tasks, err)
+	}
+	// Если задач нет, возвращается пустой список без ошибки
+	tasks, err = c.GetTasksForAgent("", 5)
+	if err != nil || tasks == nil || len(tasks) != 0 {
+		t.Errorf("expected an empty list, got %+v, %v", tasks, err)
+	}
+}
+
+func TestGetTaskCapabilities(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	c.RegisterAgent(Agent{ID: "basic-agent", Operations: []string{"+", "-", "*", "/"}})
+	c.RegisterAgent(Agent{ID: "zone-agent", Labels: map[string]string{"zone": "a", "precision": "big"}})
+	c.Calculate("", CalculateRequest{Expression: "sqrt(4)"})
+	pinned, err := c.Calculate("", CalculateRequest{Expression: "1+1", Selector: map[string]string{"zone": "a"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if saved, _ := db.GetExpressionByID(pinned.ID); saved.Selector["zone"] != "a" {
+		t.Errorf("expected the selector to be saved, got %v", saved.Selector)
+	}
+
+	// Агент без sqrt и без метки zone не может выполнить ни одну задачу
+	if _, err := c.GetTaskForAgent("basic-agent"); err != ErrNotFound {
+		t.Fatalf("expected no task for basic-agent, got %v", err)
+	}
+	// Незарегистрированный агент получает только задачи без селектора
+	res, err := c.GetTask()
+	if err != nil || res.Task.Operation != "sqrt" {
+		t.Fatalf("expected task sqrt, got %+v, %v", res, err)
+	}
+	if _, err := c.GetTask(); err != ErrNotFound {
+		t.Fatalf("expected the pinned task to be skipped, got %v", err)
+	}
+	res, err = c.GetTaskForAgent("zone-agent")
+	if err != nil || res.Task.Operation != "+" || res.Task.Selector["zone"] != "a" {
+		t.Fatalf("expected the pinned task, got %+v, %v", res, err)
+	}
+
+	_, err = c.Calculate("", CalculateRequest{Expression: "1+1", Selector: map[string]string{"": "a"}})
+	if err != ErrInvalidSelector {
+		t.Errorf("expected ErrInvalidSelector, got %v", err)
+	}
+}
+
+func TestGetTaskWithoutMatching(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	c.RegisterAgent(Agent{ID: "basic-agent", Operations: []string{"+", "-", "*", "/"}})
+	c.Calculate("", CalculateRequest{Expression: "(1+2)*(3+4)"})
+
+	// Агент умеет выполнять все задачи очереди, поэтому их не нужно проверять по одной
+	c.mu.Lock()
+	needsMatch := c.needsMatch(c.agents["basic-agent"])
+	c.mu.Unlock()
+	if needsMatch || c.queue.operations["+"] != 2 {
+		t.Fatalf("expected no matching for basic-agent, queued operations %v", c.queue.operations)
+	}
+	c.Calculate("", CalculateRequest{Expression: "sqrt(4)"})
+	c.mu.Lock()
+	needsMatch = c.needsMatch(c.agents["basic-agent"])
+	c.mu.Unlock()
+	if !needsMatch {
+		t.Errorf("expected matching once sqrt is queued")
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetTask(); err != nil {
+			t.Fatalf("expected a task, got %v", err)
+		}
+	}
+	if len(c.queue.operations) != 0 || c.queue.pinned != 0 {
+		t.Errorf("expected no queued operations, got %v, %d", c.queue.operations, c.queue.pinned)
+	}
+}
+
+func TestUnroutableTaskFails(t *testing.T) {
+	t.Setenv("TASK_ROUTING_TIMEOUT_MS", "50")
+	c := NewDistributedCalculator(db)
+	pinned, _ := c.Calculate("", CalculateRequest{Expression: "1+1", Selector: map[string]string{"zone": "a"}})
+	// Пока живых агентов нет, задача ждет
+	time.Sleep(60 * time.Millisecond)
+	c.GetTask()
+	if expr, _ := c.GetExpressionByID(pinned.ID); expr.Expression.Status != "running" {
+		t.Fatalf("expected the expression to wait for agents, got %+v", expr.Expression)
+	}
+
+	c.RegisterAgent(Agent{ID: "zone-b-agent", Labels: map[string]string{"zone": "b"}})
+	c.mu.Lock()
+	c.routedAt = time.Time{}
+	c.mu.Unlock()
+	if _, err := c.GetTaskForAgent("zone-b-agent"); err != ErrNotFound {
+		t.Fatalf("expected no task for zone-b-agent, got %v", err)
+	}
+	if expr, _ := c.GetExpressionByID(pinned.ID); expr.Expression.Status != ErrNoMatchingAgent.Error() {
+		t.Errorf("expected the expression to fail, got %+v", expr.Expression)
+	}
+}
+
+func TestAgentFunctions(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	var parseErr *calc.ParseError
+	if _, err := c.Calculate("", CalculateRequest{Expression: "hypot(3, 4)"}); !errors.As(err, &parseErr) || parseErr.Code != calc.ErrCodeUnknownFunction {
+		t.Fatalf("expected unknown function, got %v", err)
+	}
+
+	// Агент сообщает о функции, и оркестратор начинает принимать ее в выражениях
+	c.RegisterAgent(agentFromInfo(&pb.AgentInfo{
+		AgentId:    "hypot-agent",
+		Operations: []string{"+", "hypot"},
+		Functions:  []*pb.FunctionInfo{{Name: "hypot", MinArgs: 2, MaxArgs: 2}, {Name: "sqrt", MinArgs: 2, MaxArgs: 2}},
+	}))
+	c.RegisterAgent(Agent{ID: "basic-agent", Operations: []string{"+", "sqrt"}})
+	if _, err := c.Calculate("", CalculateRequest{Expression: "hypot(3, 4)"}); err != nil {
+		t.Fatalf("expected hypot to be accepted, got %v", err)
+	}
+	if _, err := c.Calculate("", CalculateRequest{Expression: "hypot(3)"}); !errors.As(err, &parseErr) || parseErr.Code != calc.ErrCodeArgumentCount {
+		t.Errorf("expected invalid argument count, got %v", err)
+	}
+	// Функции по умолчанию агенты не переопределяют
+	if _, err := c.Calculate("", CalculateRequest{Expression: "sqrt(1, 2)"}); !errors.As(err, &parseErr) || parseErr.Code != calc.ErrCodeArgumentCount {
+		t.Errorf("expected invalid argument count for sqrt, got %v", err)
+	}
+
+	if _, err := c.GetTaskForAgent("basic-agent"); err != ErrNotFound {
+		t.Fatalf("expected no task for basic-agent, got %v", err)
+	}
+	res, err := c.GetTaskForAgent("hypot-agent")
+	if err != nil || res.Task.Operation != "hypot" || len(res.Task.Args) != 2 {
+		t.Fatalf("expected task hypot(3, 4), got %+v, %v", res, err)
+	}
+
+	// Выражение, сохраненное до перезапуска, разбирается до регистрации агентов
+	functions := calc.DefaultFunctions()
+	addSavedFunctions(functions, "pricing(1, 2, 3) + sqrt(4)")
+	if _, err := parse(CalculateRequest{Expression: "pricing(1, 2, 3) + sqrt(4)"}, functions); err != nil {
+		t.Errorf("expected the saved expression to be parsed, got %v", err)
+	}
+}
+
+func TestDeadAgentLeasesReleased(t *testing.T) {
+	t.Setenv("AGENT_TIMEOUT_MS", "50")
+	c := NewDistributedCalculator(db)
+	if _, err := c.RegisterAgent(Agent{ID: "agent-1", Capacity: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Calculate("", CalculateRequest{Expression: "2+2"})
+	leased, err := c.GetTaskForAgent("agent-1")
+	if err != nil {
+		t.Fatalf("expected a task, got %v", err)
+	}
+	if _, err := c.GetTask(); err != ErrNotFound {
+		t.Fatalf("expected the task to stay leased, got %v", err)
+	}
+	agents, _ := c.GetAgents()
+	if len(agents.Agents) != 1 || agents.Agents[0].Leased != 1 {
+		t.Errorf("unexpected agents: %+v", agents.Agents)
+	}
+
+	// Агент перестал сообщать, что жив: задача возвращается в очередь, не дожидаясь
+	// окончания аренды
+	time.Sleep(60 * time.Millisecond)
+	res, err := c.GetTask()
+	if err != nil || res.Task.ID != leased.Task.ID {
+		t.Fatalf("expected the task of the dead agent, got %+v, %v", res, err)
+	}
+	if agents, _ := c.GetAgents(); len(agents.Agents) != 0 {
+		t.Errorf("expected the dead agent to be forgotten, got %+v", agents.Agents)
+	}
+}
+
+func TestDeadAgentLeasesReleasedWithoutPolling(t *testing.T) {
+	t.Setenv("AGENT_TIMEOUT_MS", "50")
+	t.Setenv("AGENT_HEARTBEAT_MS", "20")
+	c := NewDistributedCalculator(db)
+	c.RegisterAgent(Agent{ID: "silent-agent", Capacity: 1})
+	res, _ := c.Calculate("", CalculateRequest{Expression: "2+2"})
+	if _, err := c.GetTaskForAgent("silent-agent"); err != nil {
+		t.Fatalf("expected a task, got %v", err)
+	}
+
+	// Задача возвращается в очередь, хотя задачи никто не запрашивает
+	time.Sleep(150 * time.Millisecond)
+	c.mu.Lock()
+	leased, agents := len(c.taskAgents), len(c.agents)
+	c.mu.Unlock()
+	if leased != 0 || agents != 0 {
+		t.Errorf("expected the dead agent and its lease to be released, got %d leases and %d agents", leased, agents)
+	}
+	if saved, _ := db.GetTasksByExpressionID(res.ID); len(saved) != 1 || saved[0].Status != TaskStatusPending {
+		t.Errorf("expected a pending task, got %+v", saved)
+	}
+}
+
+func TestAgentRestartReleasesLeases(t *testing.T) {
+	c := NewDistributedCalculator(db)
+	c.RegisterAgent(Agent{ID: "agent-1"})
+	c.Calculate("", CalculateRequest{Expression: "2+2"})
+	leased, _ := c.GetTaskForAgent("agent-1")
+
+	if _, err := c.Heartbeat(Agent{ID: "agent-1", Version: "2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.GetTask(); err != ErrNotFound {
+		t.Fatalf("expected the task to stay leased after a heartbeat, got %v", err)
+	}
+
+	c.RegisterAgent(Agent{ID: "agent-1"})
+	res, err := c.GetTask()
+	if err != nil || res.Task.ID != leased.Task.ID {
+		t.Fatalf("expected the task of the restarted agent, got %+v, %v", res, err)
+	}
+	if _, err := c.RegisterAgent(Agent{}); err != ErrNoAgentID {
+		t.Errorf("expected ErrNoAgentID, got %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package orchestrator
+
+import (
+	"container/heap"
+	"time"
+)
+
+// queueItem — задача в очереди на выдачу агентам.
+type queueItem struct {
+	id        string
+	user      string // Пользователь, создавший выражение задачи
+	priority  int
+	operation string
+	pinned    bool      // У выражения задачи есть селектор меток
+	seq       uint64    // Порядковый номер постановки в очередь, сохраняется при возврате задачи
+	index     int       // Позиция в куче или -1, если задача выдана агенту
+	queued    time.Time // Когда задача последний раз встала в очередь
+}
+
+// taskHeap упорядочивает задачи одного пользователя по убыванию приоритета,
+// а задачи одного приоритета — в порядке постановки в очередь.
+type taskHeap []*queueItem
+
+func (h taskHeap) Len() int { return len(h) }
+
+func (h taskHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h taskHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *taskHeap) Push(x any) {
+	item := x.(*queueItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *taskHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	item.index = -1
+	*h = old[:len(old)-1]
+	return item
+}
+
+// userQueue — задачи одного пользователя и его доля в распределении агентов.
+type userQueue struct {
+	heap       taskHeap
+	pass       float64 // Виртуальное время пользователя: растет на 1/вес с каждой выданной задачей
+	leased     int     // Число выданных и еще не завершенных задач
+	dispatched int     // Сколько задач выдано с момента появления пользователя в очереди
+}
+
+// taskQueue — очередь задач с честным распределением между пользователями.
+// Агенту выдается задача пользователя с наименьшим виртуальным временем, поэтому
+// при равных весах пользователи получают задачи по очереди, а пользователь с весом 2
+// получает вдвое больше задач, чем пользователь с весом 1. Задачи одного пользователя
+// выдаются по убыванию приоритета, а при равных приоритетах — в порядке постановки.
+// Выданная агенту задача остается известной очереди, чтобы при истечении аренды
+// вернуться на прежнее место.
+type taskQueue struct {
+	users      map[string]*userQueue
+	items      map[string]*queueItem
+	weights    map[string]int // Веса пользователей, по умолчанию 1
+	seq        uint64
+	vtime      float64        // Виртуальное время последнего выбранного пользователя
+	operations map[string]int // Число ожидающих задач по операциям
+	pinned     int            // Число ожидающих задач выражений с селектором
+}
+
+func newTaskQueue() *taskQueue {
+	return &taskQueue{
+		users:      make(map[string]*userQueue),
+		items:      make(map[string]*queueItem),
+		weights:    make(map[string]int),
+		operations: make(map[string]int),
+	}
+}
+
+// weight возвращает вес пользователя.
+func (q *taskQueue) weight(userID string) int {
+	if weight, ok := q.weights[userID]; ok {
+		return weight
+	}
+	return 1
+}
+
+// setWeight задает вес пользователя.
+func (q *taskQueue) setWeight(userID string, weight int) {
+	q.weights[userID] = weight
+}
+
+// push ставит задачу в очередь ее пользователя. Пользователь, у которого не было
+// ожидающих задач, не получает преимущества за время простоя.
+func (q *taskQueue) push(item *queueItem) {
+	uq, ok := q.users[item.user]
+	if !ok {
+		uq = &userQueue{}
+		q.users[item.user] = uq
+	}
+	if uq.heap.Len() == 0 && uq.pass < q.vtime {
+		uq.pass = q.vtime
+	}
+	item.queued = time.Now()
+	heap.Push(&uq.heap, item)
+	q.operations[item.operation]++
+	if item.pinned {
+		q.pinned++
+	}
+}
+
+// unqueue учитывает, что задача больше не ожидает в очереди.
+func (q *taskQueue) unqueue(item *queueItem) {
+	if q.operations[item.operation]--; q.operations[item.operation] == 0 {
+		delete(q.operations, item.operation)
+	}
+	if item.pinned {
+		q.pinned--
+	}
+}
+
+// add ставит новую задачу пользователя в конец очереди ее приоритета.
+func (q *taskQueue) add(task Task, userID string) {
+	q.seq++
+	item := &queueItem{
+		id:        task.ID,
+		user:      userID,
+		priority:  task.Priority,
+		operation: task.Operation,
+		pinned:    len(task.Selector) > 0,
+		seq:       q.seq,
+	}
+	q.items[task.ID] = item
+	q.push(item)
+}
+
+// waitingSince возвращает задачи, которые ожидают в очереди с момента before или дольше.
+func (q *taskQueue) waitingSince(before time.Time) []string {
+	var ids []string
+	for id, item := range q.items {
+		if item.index >= 0 && !item.queued.After(before) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// first возвращает задачу пользователя, которая выдается первой из подходящих
+// под match, или nil, если подходящих задач нет. Если match равен nil, подходит
+// любая задача.
+func (uq *userQueue) first(match func(id string) bool) *queueItem {
+	if uq.heap.Len() == 0 {
+		return nil
+	}
+	if match == nil {
+		return uq.heap[0]
+	}
+	var best *queueItem
+	for _, item := range uq.heap {
+		if match(item.id) && (best == nil || uq.heap.Less(item.index, best.index)) {
+			best = item
+		}
+	}
+	return best
+}
+
+// pop извлекает следующую задачу из тех, для которых match возвращает true.
+// Если match равен nil, подходит любая задача. Возвращает false, если
+// подходящих задач нет.
+func (q *taskQueue) pop(match func(id string) bool) (string, bool) {
+	var next *userQueue
+	var nextUser string
+	var nextItem *queueItem
+	for userID, uq := range q.users {
+		item := uq.first(match)
+		if item == nil {
+			continue
+		}
+		// При равном виртуальном времени порядок определяется идентификатором пользователя
+		if next == nil || uq.pass < next.pass || (uq.pass == next.pass && userID < nextUser) {
+			next, nextUser, nextItem = uq, userID, item
+		}
+	}
+	if next == nil {
+		return "", false
+	}
+	item := heap.Remove(&next.heap, nextItem.index).(*queueItem)
+	q.unqueue(item)
+	q.vtime = next.pass
+	next.pass += 1 / float64(q.weight(nextUser))
+	next.leased++
+	next.dispatched++
+	return item.id, true
+}
+
+// requeue возвращает выданную задачу в очередь на ее прежнее место.
+func (q *taskQueue) requeue(id string) {
+	item, ok := q.items[id]
+	if ok && item.index < 0 {
+		q.users[item.user].leased--
+		q.push(item)
+	}
+}
+
+// remove удаляет задачу из очереди.
+func (q *taskQueue) remove(id string) {
+	item, ok := q.items[id]
+	if !ok {
+		return
+	}
+	delete(q.items, id)
+	uq := q.users[item.user]
+	if item.index >= 0 {
+		heap.Remove(&uq.heap, item.index)
+		q.unqueue(item)
+	} else {
+		uq.leased--
+	}
+	if uq.heap.Len() == 0 && uq.leased == 0 {
+		delete(q.users, item.user)
+	}
+}
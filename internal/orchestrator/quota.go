@@ -0,0 +1,156 @@
+package orchestrator
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/denis-gr/GOCACL_DISTRIBUTED/pkg/calc"
+)
+
+// Ограничения, которые действуют для каждого пользователя API v1. Все запросы
+// API v0 считаются запросами одного пустого пользователя и делят его ограничения.
+const (
+	LimitRunningExpressions      = "running_expressions"       // Число одновременно вычисляемых выражений
+	LimitOperationsPerExpression = "operations_per_expression" // Число операций в одном выражении
+	LimitSubmissionsPerMinute    = "submissions_per_minute"    // Число запросов на вычисление в минуту
+)
+
+// rateWindow — окно, в котором считаются запросы на вычисление.
+const rateWindow = time.Minute
+
+// runningRetryAfter — через сколько предлагается повторить запрос, если
+// превышено число одновременно вычисляемых выражений.
+const runningRetryAfter = time.Second
+
+// QuotaError возвращается, если запрос превышает ограничение пользователя.
+type QuotaError struct {
+	Limit      string        // Одно из значений Limit*
+	Max        int           // Значение ограничения
+	RetryAfter time.Duration // Через сколько повторить запрос, 0 — повтор не поможет
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded: %s is limited to %d", e.Limit, e.Max)
+}
+
+// quotaLimit возвращает ограничение из переменной окружения. 0 означает, что ограничения нет.
+func quotaLimit(limit string) int {
+	var name string
+	switch limit {
+	case LimitRunningExpressions:
+		name = "QUOTA_RUNNING_EXPRESSIONS"
+	case LimitOperationsPerExpression:
+		name = "QUOTA_OPERATIONS_PER_EXPRESSION"
+	case LimitSubmissionsPerMinute:
+		name = "QUOTA_SUBMISSIONS_PER_MINUTE"
+	}
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value < 0 {
+		return 0
+	}
+	return value
+}
+
+// checkOperations проверяет, что в выражении не больше операций, чем разрешено.
+// Повтор такого запроса не поможет, поэтому RetryAfter не задается.
+func checkOperations(graph *calc.Graph) error {
+	max := quotaLimit(LimitOperationsPerExpression)
+	if max == 0 {
+		return nil
+	}
+	operations := 0
+	for _, node := range graph.Nodes {
+		if node.Operation != "" {
+			operations++
+		}
+	}
+	if operations > max {
+		return &QuotaError{Limit: LimitOperationsPerExpression, Max: max}
+	}
+	return nil
+}
+
+// admit проверяет, может ли пользователь запустить еще count выражений, и учитывает
+// их как count запросов в ограничении числа запросов в минуту. Запущенные выражения
+// считаются вычисляемыми до вызова release, чтобы одновременные запросы не превысили ограничение.
+func (f *DistributedCalculator) admit(creatorID string, count int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+
+	if max := quotaLimit(LimitRunningExpressions); max > 0 && f.runningCount(creatorID)+count > max {
+		quotaErr := &QuotaError{Limit: LimitRunningExpressions, Max: max}
+		// Пакет, который больше самого ограничения, не поместится и позже
+		if count <= max {
+			quotaErr.RetryAfter = runningRetryAfter
+		}
+		return quotaErr
+	}
+	submissions := f.recentSubmissions(creatorID, now)
+	if max := quotaLimit(LimitSubmissionsPerMinute); max > 0 && len(submissions)+count > max {
+		quotaErr := &QuotaError{Limit: LimitSubmissionsPerMinute, Max: max}
+		// Повторить можно, когда истечет столько ранних запросов, сколько не хватает
+		if count <= max {
+			quotaErr.RetryAfter = submissions[len(submissions)+count-max-1].Add(rateWindow).Sub(now)
+		}
+		return quotaErr
+	}
+	for range count {
+		submissions = append(submissions, now)
+	}
+	f.submissions[creatorID] = submissions
+	f.admitting[creatorID] += count
+	return nil
+}
+
+// release снимает учет выражений, запущенных после admit.
+func (f *DistributedCalculator) release(creatorID string, count int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.admitting[creatorID] -= count
+	if f.admitting[creatorID] <= 0 {
+		delete(f.admitting, creatorID)
+	}
+}
+
+// runningCount возвращает число вычисляемых выражений пользователя, включая
+// те, что еще запускаются. Вызывается с захваченным f.mu.
+func (f *DistributedCalculator) runningCount(creatorID string) int {
+	count := f.admitting[creatorID]
+	for id := range f.evaluations {
+		if f.expressions[id].CreatorID == creatorID {
+			count++
+		}
+	}
+	return count
+}
+
+// recentSubmissions возвращает время запросов пользователя за последнюю минуту
+// и забывает более ранние запросы. Вызывается с захваченным f.mu.
+func (f *DistributedCalculator) recentSubmissions(creatorID string, now time.Time) []time.Time {
+	submissions := f.submissions[creatorID]
+	i := 0
+	for i < len(submissions) && !now.Before(submissions[i].Add(rateWindow)) {
+		i++
+	}
+	submissions = submissions[i:]
+	if len(submissions) == 0 {
+		delete(f.submissions, creatorID)
+	}
+	return submissions
+}
+
+// GetUsage возвращает текущее использование ограничений пользователем.
+func (f *DistributedCalculator) GetUsage(userID string) (UsageResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return UsageResponse{
+		RunningExpressions:           f.runningCount(userID),
+		RunningExpressionsLimit:      quotaLimit(LimitRunningExpressions),
+		SubmissionsLastMinute:        len(f.recentSubmissions(userID, time.Now())),
+		SubmissionsPerMinuteLimit:    quotaLimit(LimitSubmissionsPerMinute),
+		OperationsPerExpressionLimit: quotaLimit(LimitOperationsPerExpression),
+	}, nil
+}
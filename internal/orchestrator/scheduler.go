@@ -0,0 +1,68 @@
+package orchestrator
+
+import (
+	"errors"
+	"sort"
+)
+
+// MaxWeight — наибольший вес пользователя в планировщике задач.
+const MaxWeight = 1000
+
+// ErrInvalidWeight возвращается, если вес пользователя выходит за допустимые пределы.
+var ErrInvalidWeight = errors.New("weight must be between 1 and 1000")
+
+// SetUserWeight задает вес пользователя: пользователь с весом 2 получает вдвое
+// больше задач, чем пользователь с весом 1, если задачи есть у обоих.
+// Возвращает ErrNotFound, если такого пользователя нет.
+func (f *DistributedCalculator) SetUserWeight(userID string, weight int) error {
+	if weight < 1 || weight > MaxWeight {
+		return ErrInvalidWeight
+	}
+	if err := f.db.SetUserWeight(userID, weight); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queue.setWeight(userID, weight)
+	return nil
+}
+
+// GetScheduler возвращает веса пользователей и число их задач в очереди.
+// Сначала перечисляются зарегистрированные пользователи, затем остальные
+// владельцы задач, например, пустой пользователь API v0.
+func (f *DistributedCalculator) GetScheduler() (SchedulerResponse, error) {
+	users, err := f.db.GetUserAll()
+	if err != nil {
+		return SchedulerResponse{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := SchedulerResponse{Users: []SchedulerUser{}}
+	known := make(map[string]bool)
+	for _, user := range users {
+		known[user.ID] = true
+		res.Users = append(res.Users, f.schedulerUser(user.ID, user.Username))
+	}
+	others := []string{}
+	for userID := range f.queue.users {
+		if !known[userID] {
+			others = append(others, userID)
+		}
+	}
+	sort.Strings(others)
+	for _, userID := range others {
+		res.Users = append(res.Users, f.schedulerUser(userID, ""))
+	}
+	return res, nil
+}
+
+// schedulerUser описывает состояние пользователя в очереди. Вызывается с захваченным f.mu.
+func (f *DistributedCalculator) schedulerUser(userID, username string) SchedulerUser {
+	user := SchedulerUser{UserID: userID, Username: username, Weight: f.queue.weight(userID)}
+	if uq, ok := f.queue.users[userID]; ok {
+		user.Queued = uq.heap.Len()
+		user.Leased = uq.leased
+		user.Dispatched = uq.dispatched
+	}
+	return user
+}
@@ -1,9 +1,23 @@
 // Package orchestrator содержит схемы данных для пакета orchestrator.
 package orchestrator
 
+import (
+	"time"
+
+	"github.com/denis-gr/GOCACL_DISTRIBUTED/pkg/calc"
+)
+
 // CalculateRequest Структура для запроса на добавление вычисления арифметического выражения
 type CalculateRequest struct {
-	Expression string `json:"expression"`
+	Expression string             `json:"expression"`
+	Variables  map[string]float64 `json:"variables,omitempty"`
+	Mode       string             `json:"mode,omitempty"`     // float (по умолчанию), decimal или rational
+	Label      string             `json:"label,omitempty"`    // Метка клиента, например, номер строки в пакете
+	Priority   int                `json:"priority,omitempty"` // От -10 до 10, по умолчанию 0: задачи с большим приоритетом выдаются раньше
+	Selector   map[string]string  `json:"selector,omitempty"` // Метки, которые должны быть у агента, выполняющего задачи выражения
+	// Ключ идемпотентности из заголовка Idempotency-Key: повторный запрос
+	// с тем же ключом возвращает уже созданное выражение
+	IdempotencyKey string `json:"-"`
 }
 
 // CalculateResponse Структура для ответа на добавление вычисления арифметического выражения
@@ -11,11 +25,46 @@ type CalculateResponse struct {
 	ID string `json:"id"`
 }
 
+// BatchCalculateResponse Структура для ответа на добавление пакета выражений
+type BatchCalculateResponse struct {
+	BatchID string   `json:"batch_id"`
+	IDs     []string `json:"ids"` // Идентификаторы выражений в порядке их отправки
+}
+
+// BatchErrorResponse Структура для ответа на пакет с некорректным выражением
+type BatchErrorResponse struct {
+	Index   int              `json:"index"`           // Номер некорректного выражения в пакете, начиная с 0
+	Error   *calc.ParseError `json:"error,omitempty"` // Синтаксическая ошибка
+	Message string           `json:"message"`
+}
+
+// BatchResponse Структура для ответа на получение прогресса пакета
+type BatchResponse struct {
+	ID          string       `json:"id"`
+	Total       int          `json:"total"`
+	Running     int          `json:"running"`
+	Done        int          `json:"done"`   // Вычислены успешно
+	Failed      int          `json:"failed"` // Завершились с ошибкой или отменены
+	Expressions []Expression `json:"expressions"`
+}
+
+// ParseErrorResponse Структура для ответа на запрос с синтаксически некорректным выражением
+type ParseErrorResponse struct {
+	Error *calc.ParseError `json:"error"`
+}
+
 // Expression Структура для выражения
 type Expression struct {
-	ID     string  `json:"id"`
-	Status string  `json:"status"`
-	Result float64 `json:"result"`
+	ID          string            `json:"id"`
+	Status      string            `json:"status"`
+	Result      float64           `json:"result"`
+	Mode        string            `json:"mode,omitempty"`
+	ExactResult string            `json:"exact_result,omitempty"` // Результат без потери точности: десятичная строка или дробь, например, "22/7"
+	BatchID     string            `json:"batch_id,omitempty"`
+	Label       string            `json:"label,omitempty"`
+	Priority    int               `json:"priority,omitempty"`
+	Selector    map[string]string `json:"selector,omitempty"`
+	CreatorID   string            `json:"-"` // Пользователь, создавший выражение, пустой для API v0
 }
 
 // ExpressionsResponse Структура для ответа на получение списка выражений
@@ -30,11 +79,16 @@ type ExpressionResponse struct {
 
 // Task Структура для задачи
 type Task struct {
-	ID            string  `json:"id"`
-	Arg1          float64 `json:"arg1"`
-	Arg2          float64 `json:"arg2"`
-	Operation     string  `json:"operation"`
-	OperationTime int64   `json:"operation_time"`
+	ID            string            `json:"id"`
+	Arg1          float64           `json:"arg1"`
+	Arg2          float64           `json:"arg2"`
+	Args          []float64         `json:"args"`
+	Operation     string            `json:"operation"`
+	OperationTime int64             `json:"operation_time"`
+	Mode          string            `json:"mode,omitempty"`
+	ExactArgs     []string          `json:"exact_args,omitempty"`
+	Priority      int               `json:"priority,omitempty"` // Приоритет выражения, которому принадлежит задача
+	Selector      map[string]string `json:"selector,omitempty"` // Селектор меток выражения, которому принадлежит задача
 }
 
 // TaskResponse Структура для ответа на получение задачи для выполнения
@@ -44,18 +98,29 @@ type TaskResponse struct {
 
 // TaskResultRequest Структура для запроса на прием результата обработки данных
 type TaskResultRequest struct {
-	ID     string  `json:"id"`
-	Result float64 `json:"result"`
+	ID          string  `json:"id"`
+	Result      float64 `json:"result"`
+	ExactResult string  `json:"exact_result,omitempty"`
+	// Если задачу не удалось выполнить, агент передает код и описание ошибки
+	// вместо результата, и выражение завершается с этой ошибкой
+	ErrorCode    string `json:"error_code,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
 }
 
 // TaskFull Структура для задачи
 type TaskFull struct {
-	ID            string  `json:"id"`
-	Arg1          float64 `json:"arg1"`
-	Arg2          float64 `json:"arg2"`
-	Operation     string  `json:"operation"`
-	OperationTime int64   `json:"operation_time"`
-	IsBusy        bool    `json:"is_busy"`
+	ID            string            `json:"id"`
+	Arg1          float64           `json:"arg1"`
+	Arg2          float64           `json:"arg2"`
+	Args          []float64         `json:"args"`
+	Operation     string            `json:"operation"`
+	OperationTime int64             `json:"operation_time"`
+	Mode          string            `json:"mode,omitempty"`
+	ExactArgs     []string          `json:"exact_args,omitempty"`
+	Priority      int               `json:"priority,omitempty"`
+	Selector      map[string]string `json:"selector,omitempty"`
+	IsBusy        bool              `json:"is_busy"`
+	Attempts      int               `json:"attempts"`
 }
 
 // TaskFullResponse Структура для ответа на получение задачи для выполнения
@@ -65,11 +130,42 @@ type TaskFullResponse struct {
 
 // ExpressionDB Структура для выражения в базе данных
 type ExpressionDB struct {
-	ID         string  `json:"id"`
-	Expression string  `json:"expression"`
-	Status     string  `json:"status"`
-	Result     float64 `json:"result"`
-	CreatorId  string  `json:"creator_id"`
+	ID          string             `json:"id"`
+	Expression  string             `json:"expression"`
+	Status      string             `json:"status"`
+	Result      float64            `json:"result"`
+	CreatorId   string             `json:"creator_id"`
+	Variables   map[string]float64 `json:"variables"`
+	Mode        string             `json:"mode"`
+	ExactResult string             `json:"exact_result"`
+	BatchID     string             `json:"batch_id"`
+	Label       string             `json:"label"`
+	Priority    int                `json:"priority"`
+	Selector    map[string]string  `json:"selector"`
+}
+
+// Статусы задач в базе данных
+const (
+	TaskStatusPending = "pending"
+	TaskStatusLeased  = "leased"
+	TaskStatusDone    = "done"
+)
+
+// TaskDB Структура для задачи в базе данных
+type TaskDB struct {
+	ID            string    `json:"id"`
+	ExpressionID  string    `json:"expression_id"`
+	Node          int       `json:"node"`
+	Operation     string    `json:"operation"`
+	Arg1          float64   `json:"arg1"`
+	Arg2          float64   `json:"arg2"`
+	Args          []float64 `json:"args"`
+	ExactArgs     []string  `json:"exact_args"`
+	OperationTime int64     `json:"operation_time"`
+	Status        string    `json:"status"`
+	Result        float64   `json:"result"`
+	ExactResult   string    `json:"exact_result"`
+	Attempts      int       `json:"attempts"`
 }
 
 // UserDB Структура для пользователя в базе данных
@@ -91,6 +187,69 @@ type UserPublic struct {
 	Username string `json:"username"`
 }
 
+// UsageResponse Структура для ответа на получение использования ограничений пользователя.
+// Ограничение 0 означает, что ограничения нет.
+type UsageResponse struct {
+	RunningExpressions           int `json:"running_expressions"`
+	RunningExpressionsLimit      int `json:"running_expressions_limit"`
+	SubmissionsLastMinute        int `json:"submissions_last_minute"` // Каждое выражение пакета считается отдельным запросом
+	SubmissionsPerMinuteLimit    int `json:"submissions_per_minute_limit"`
+	OperationsPerExpressionLimit int `json:"operations_per_expression_limit"`
+}
+
+// QuotaErrorResponse Структура для ответа на запрос, превышающий ограничение пользователя
+type QuotaErrorResponse struct {
+	Limit   string `json:"limit"` // Превышенное ограничение, например, submissions_per_minute
+	Max     int    `json:"max"`
+	Message string `json:"message"`
+}
+
+// Agent Структура для агента, выполняющего задачи
+type Agent struct {
+	ID           string            `json:"id"`
+	Hostname     string            `json:"hostname"`
+	Version      string            `json:"version"`
+	Capacity     int               `json:"capacity"`            // Число задач, которые агент выполняет одновременно
+	Operations   []string          `json:"operations"`          // Операции, которые умеет выполнять агент
+	Labels       map[string]string `json:"labels,omitempty"`    // Метки агента, например, zone=a
+	Functions    []AgentFunction   `json:"functions,omitempty"` // Операции агента, которые вызываются в выражениях как функции
+	RegisteredAt time.Time         `json:"registered_at"`
+	LastSeen     time.Time         `json:"last_seen"` // Время последнего сигнала или запроса задачи
+	Leased       int               `json:"leased"`    // Число выданных агенту задач
+}
+
+// AgentFunction Структура для операции агента, которая вызывается в выражениях как функция
+type AgentFunction struct {
+	Name    string `json:"name"`
+	MinArgs int    `json:"min_args"`
+	MaxArgs int    `json:"max_args"` // -1 — без ограничения
+}
+
+// AgentsResponse Структура для ответа на получение списка агентов
+type AgentsResponse struct {
+	Agents []Agent `json:"agents"`
+}
+
+// SchedulerUser Структура для состояния пользователя в планировщике задач
+type SchedulerUser struct {
+	UserID     string `json:"user_id"` // Пустой для выражений API v0
+	Username   string `json:"username,omitempty"`
+	Weight     int    `json:"weight"`     // Доля агентов, которую получает пользователь, по умолчанию 1
+	Queued     int    `json:"queued"`     // Задачи, ожидающие выдачи агентам
+	Leased     int    `json:"leased"`     // Задачи, выданные агентам
+	Dispatched int    `json:"dispatched"` // Задачи, выданные с тех пор, как у пользователя появились задачи
+}
+
+// SchedulerResponse Структура для ответа на получение состояния планировщика задач
+type SchedulerResponse struct {
+	Users []SchedulerUser `json:"users"`
+}
+
+// UserWeightRequest Структура для запроса на изменение веса пользователя
+type UserWeightRequest struct {
+	Weight int `json:"weight"`
+}
+
 // UserLoginForm Структура для входа пользователя
 type UserLoginForm struct {
 	Username string `json:"login"`
@@ -4,16 +4,22 @@ package orchestrator
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	pb "github.com/denis-gr/GOCACL_DISTRIBUTED/internal/gen"
+	"github.com/denis-gr/GOCACL_DISTRIBUTED/pkg/calc"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 )
@@ -75,10 +81,20 @@ func NewRouter() http.Handler {
 
 	router.HandleFunc("/api/v1/calculate", calculateHandler).Methods("POST")
 	router.HandleFunc("/api/v1/expressions", getExpressionsHandler).Methods("GET")
+	router.HandleFunc("/api/v1/calculate/batch", calculateBatchHandler).Methods("POST")
+	router.HandleFunc("/api/v1/batches/{id}", getBatchHandler).Methods("GET")
+	router.HandleFunc("/api/v1/expressions/events", expressionEventsHandler).Methods("GET")
 	router.HandleFunc("/api/v1/expressions/{id}", getExpressionByIDHandler).Methods("GET")
+	router.HandleFunc("/api/v1/expressions/{id}/events", expressionEventsHandler).Methods("GET")
+	router.HandleFunc("/api/v1/expressions/{id}", cancelExpressionHandler).Methods("DELETE")
+	router.HandleFunc("/api/v1/me/usage", getUsageHandler).Methods("GET")
 	router.HandleFunc("/api/v1/register", registerUserHandler).Methods("POST")
 	router.HandleFunc("/api/v1/login", loginUserHandler).Methods("POST")
 
+	router.HandleFunc("/api/v1/admin/scheduler", getSchedulerHandler).Methods("GET")
+	router.HandleFunc("/api/v1/admin/agents", getAgentsHandler).Methods("GET")
+	router.HandleFunc("/api/v1/admin/users/{id}/weight", setUserWeightHandler).Methods("PUT")
+
 	return router
 }
 
@@ -163,7 +179,11 @@ func checkJWTToken(r *http.Request) (string, error) {
 	if tokenString == "" {
 		return "", http.ErrNoCookie
 	}
-	tokenString = tokenString[len("Bearer "):]
+	return parseJWTToken(tokenString[len("Bearer "):])
+}
+
+// parseJWTToken проверяет JWT-токен и возвращает идентификатор пользователя.
+func parseJWTToken(tokenString string) (string, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, http.ErrNoCookie
@@ -192,20 +212,144 @@ func checkJWTToken(r *http.Request) (string, error) {
 	return "", http.ErrNoCookie
 }
 
+// maxIdempotencyKeyLength ограничивает длину заголовка Idempotency-Key.
+const maxIdempotencyKeyLength = 255
+
 // calculateHandler обрабатывает запрос на добавление вычисления арифметического выражения.
+// Повторный запрос с тем же заголовком Idempotency-Key возвращает ранее созданное выражение.
+// При превышении ограничений running_expressions и submissions_per_minute возвращается 429
+// с заголовком Retry-After, а при превышении operations_per_expression — 400 без него:
+// то же выражение не будет принято и позже.
 func calculateHandler(w http.ResponseWriter, r *http.Request) {
 	var req CalculateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, http.StatusText(http.StatusUnprocessableEntity), http.StatusUnprocessableEntity)
 		return
 	}
-	res, _ := calculator.Calculate(req)
 	user_id, err := checkJWTToken(r)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 		return
 	}
-	_, err = db.CreateExpressionWithId(user_id, res.ID, CalculateRequest{Expression: req.Expression})
+	req.IdempotencyKey = r.Header.Get("Idempotency-Key")
+	if len(req.IdempotencyKey) > maxIdempotencyKeyLength {
+		http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+		return
+	}
+	res, err := calculator.Calculate(user_id, req)
+	if writeParseError(w, err) || writeQuotaError(w, err) {
+		return
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// calculateBatchHandler обрабатывает запрос на добавление пакета выражений.
+// Тело запроса — массив объектов CalculateRequest, каждому можно задать метку label.
+func calculateBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var reqs []CalculateRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+		http.Error(w, http.StatusText(http.StatusUnprocessableEntity), http.StatusUnprocessableEntity)
+		return
+	}
+	userID, err := checkJWTToken(r)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	res, err := calculator.CalculateBatch(userID, reqs)
+	var itemErr *BatchItemError
+	if errors.As(err, &itemErr) {
+		errRes := BatchErrorResponse{Index: itemErr.Index, Message: itemErr.Err.Error()}
+		errors.As(itemErr.Err, &errRes.Error)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		err = json.NewEncoder(w).Encode(errRes)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+	if writeQuotaError(w, err) {
+		return
+	}
+	if err == ErrEmptyBatch || err == ErrBatchTooLarge {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// getBatchHandler обрабатывает запрос на получение прогресса пакета выражений.
+func getBatchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := checkJWTToken(r)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	vars := mux.Vars(r)
+	res, err := calculator.GetBatch(vars["id"], userID)
+	if err == ErrNotFound {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// writeQuotaError отвечает на запрос, превышающий ограничение пользователя: статусом 429
+// с заголовком Retry-After, если запрос можно повторить позже, и статусом 400, если нет.
+// Возвращает true, если ответ был записан.
+func writeQuotaError(w http.ResponseWriter, err error) bool {
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	status := http.StatusBadRequest
+	if quotaErr.RetryAfter > 0 {
+		seconds := int64((quotaErr.RetryAfter + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+		status = http.StatusTooManyRequests
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(QuotaErrorResponse{Limit: quotaErr.Limit, Max: quotaErr.Max, Message: quotaErr.Error()})
+	if err != nil {
+		panic(err)
+	}
+	return true
+}
+
+// getUsageHandler обрабатывает запрос на получение использования ограничений пользователем.
+func getUsageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := checkJWTToken(r)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	res, err := calculator.GetUsage(userID)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
@@ -217,14 +361,39 @@ func calculateHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// writeParseError отвечает статусом 400 с описанием ошибки, если выражение синтаксически некорректно
+// или запрошены неизвестный режим вычисления, недопустимый приоритет или селектор меток.
+// Возвращает true, если ответ был записан.
+func writeParseError(w http.ResponseWriter, err error) bool {
+	if errors.Is(err, calc.ErrUnknownMode) || errors.Is(err, ErrInvalidPriority) || errors.Is(err, ErrInvalidSelector) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return true
+	}
+	var parseErr *calc.ParseError
+	if !errors.As(err, &parseErr) {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	err = json.NewEncoder(w).Encode(ParseErrorResponse{Error: parseErr})
+	if err != nil {
+		panic(err)
+	}
+	return true
+}
+
 // getExpressionsHandler обрабатывает запрос на получение списка выражений.
 func getExpressionsHandler(w http.ResponseWriter, r *http.Request) {
-	_, err := checkJWTToken(r)
+	userID, err := checkJWTToken(r)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 		return
 	}
-	res, _ := calculator.GetExpressions()
+	res, err := calculator.GetExpressionsByUserID(userID)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(res)
 	if err != nil {
@@ -234,14 +403,27 @@ func getExpressionsHandler(w http.ResponseWriter, r *http.Request) {
 
 // getExpressionByIDHandler обрабатывает запрос на получение выражения по его идентификатору.
 func getExpressionByIDHandler(w http.ResponseWriter, r *http.Request) {
-	_, err := checkJWTToken(r)
+	userID, err := checkJWTToken(r)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 		return
 	}
 	vars := mux.Vars(r)
 	id := vars["id"]
-	res, err := calculator.GetExpressionByID(id)
+	var res ExpressionResponse
+	if wait := r.URL.Query().Get("wait"); wait != "" {
+		// Долгий опрос: ответ откладывается до завершения вычисления или истечения времени ожидания
+		timeout, parseErr := parseWait(wait)
+		if parseErr != nil {
+			http.Error(w, parseErr.Error(), http.StatusBadRequest)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		res, err = calculator.WaitExpression(ctx, id, userID)
+	} else {
+		res, err = calculator.GetUserExpressionByID(id, userID)
+	}
 	if err == ErrNotFound {
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
@@ -253,36 +435,363 @@ func getExpressionByIDHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// maxWait ограничивает время ожидания результата в параметре wait.
+const maxWait = 2 * time.Minute
+
+// parseWait разбирает время ожидания из параметра wait: длительность, например,
+// "30s" или "1m", либо число секунд. Слишком долгое ожидание сокращается до maxWait.
+func parseWait(wait string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(wait)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(wait)
+		if convErr != nil {
+			return 0, fmt.Errorf("invalid wait %q: %w", wait, err)
+		}
+		if seconds < 0 {
+			return 0, fmt.Errorf("invalid wait %q: negative duration", wait)
+		}
+		// Число секунд ограничивается до умножения, чтобы time.Duration не переполнился
+		timeout = time.Duration(min(seconds, int(maxWait/time.Second))) * time.Second
+	}
+	if timeout < 0 {
+		return 0, fmt.Errorf("invalid wait %q: negative duration", wait)
+	}
+	return min(timeout, maxWait), nil
+}
+
+// sseKeepAlive — интервал между комментариями, которые не дают закрыть простаивающее SSE-соединение.
+const sseKeepAlive = 15 * time.Second
+
+// expressionEventsHandler передает события об изменении выражений пользователя
+// в формате Server-Sent Events. Если в пути указан идентификатор, передаются
+// только события об этом выражении: сначала его текущее состояние, а после
+// завершения вычисления поток закрывается.
+func expressionEventsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := checkJWTToken(r)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	id := mux.Vars(r)["id"]
+
+	// Подписка оформляется до чтения текущего состояния, чтобы не пропустить изменения между ними
+	events, unsubscribe := calculator.Subscribe(userID, id)
+	defer unsubscribe()
+	var current ExpressionResponse
+	if id != "" {
+		current, err = calculator.GetUserExpressionByID(id, userID)
+		if err == ErrNotFound {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if id != "" {
+		writeEvent(w, Event{Type: EventExpression, Expression: current.Expression})
+		if current.Expression.Status != "running" {
+			flusher.Flush()
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-events:
+			writeEvent(w, event)
+			if id != "" && event.Type == EventExpression && event.Expression.Status != "running" {
+				flusher.Flush()
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent записывает событие в формате Server-Sent Events.
+func writeEvent(w http.ResponseWriter, event Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+}
+
+// cancelExpressionHandler обрабатывает запрос на отмену вычисления выражения.
+// Отменить можно только свое выражение, которое еще вычисляется.
+func cancelExpressionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := checkJWTToken(r)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	vars := mux.Vars(r)
+	id := vars["id"]
+	if _, err := calculator.GetUserExpressionByID(id, userID); err == ErrNotFound {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	res, err := calculator.CancelExpression(id)
+	if err == ErrNotFound {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if err == ErrNotRunning {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		panic(err)
+	}
+}
+
 type OrchestratorGRPCServer struct {
 	pb.UnimplementedOrchestratorServiceServer
 }
 
+// agentIDMetadata — ключ метаданных gRPC, в котором агент передает свой идентификатор.
+const agentIDMetadata = "x-agent-id"
+
+// agentIDFromContext возвращает идентификатор агента из метаданных запроса.
+func agentIDFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(agentIDMetadata); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// agentFromInfo преобразует описание агента из запроса gRPC.
+func agentFromInfo(in *pb.AgentInfo) Agent {
+	agent := Agent{
+		ID:         in.AgentId,
+		Hostname:   in.Hostname,
+		Version:    in.Version,
+		Capacity:   int(in.Capacity),
+		Operations: in.Operations,
+		Labels:     in.Labels,
+	}
+	for _, function := range in.Functions {
+		agent.Functions = append(agent.Functions, AgentFunction{
+			Name:    function.Name,
+			MinArgs: int(function.MinArgs),
+			MaxArgs: int(function.MaxArgs),
+		})
+	}
+	return agent
+}
+
 func (s *OrchestratorGRPCServer) GetTask(ctx context.Context, in *pb.Empty) (*pb.TaskResponse, error) {
-	task, err := calculator.GetTask()
+	task, err := calculator.GetTaskForAgent(agentIDFromContext(ctx))
 	if err == ErrNotFound {
 		return nil, status.Errorf(codes.NotFound, "task not found") // Добавлено сообщение об ошибке
 	}
 	if err != nil {
 		return nil, status.Errorf(codes.Unknown, "failed to get task: %v", err) // Добавлено сообщение об ошибке
 	}
-	return &pb.TaskResponse{
-		Task: &pb.Task{
-			Id:            task.Task.ID,
-			Operation:     task.Task.Operation,
-			Arg1:          task.Task.Arg1,
-			Arg2:          task.Task.Arg2,
-			OperationTime: task.Task.OperationTime,
-		},
-	}, nil
+	return &pb.TaskResponse{Task: taskToProto(task.Task)}, nil
+}
+
+// taskToProto преобразует задачу в сообщение gRPC.
+func taskToProto(task Task) *pb.Task {
+	return &pb.Task{
+		Id:            task.ID,
+		Operation:     task.Operation,
+		Arg1:          task.Arg1,
+		Arg2:          task.Arg2,
+		Args:          task.Args,
+		OperationTime: task.OperationTime,
+		Mode:          task.Mode,
+		ExactArgs:     task.ExactArgs,
+		Priority:      int32(task.Priority),
+	}
+}
+
+// resultFromProto преобразует результат задачи из сообщения gRPC.
+func resultFromProto(in *pb.TaskResultRequest) TaskResultRequest {
+	return TaskResultRequest{
+		ID:           in.Id,
+		Result:       in.Result,
+		ExactResult:  in.ExactResult,
+		ErrorCode:    in.ErrorCode,
+		ErrorMessage: in.ErrorMessage,
+	}
 }
 
 func (s *OrchestratorGRPCServer) SendResult(ctx context.Context, in *pb.TaskResultRequest) (*pb.Empty, error) {
-	err := calculator.PostTaskResult(TaskResultRequest{
-		ID:     in.Id,
-		Result: in.Result,
-	})
+	err := calculator.PostTaskResult(resultFromProto(in))
+	if err != nil {
+		return nil, err
+	}
+	return &pb.Empty{}, nil
+}
+
+// GetTasks выдает агенту до max_count задач за один запрос. Если задач нет,
+// возвращается пустой список, а не ошибка NotFound.
+func (s *OrchestratorGRPCServer) GetTasks(ctx context.Context, in *pb.GetTasksRequest) (*pb.TasksResponse, error) {
+	tasks, err := calculator.GetTasksForAgent(agentIDFromContext(ctx), int(in.MaxCount))
+	if err != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to get tasks: %v", err)
+	}
+	res := &pb.TasksResponse{Tasks: make([]*pb.Task, 0, len(tasks))}
+	for _, task := range tasks {
+		res.Tasks = append(res.Tasks, taskToProto(task))
+	}
+	return res, nil
+}
+
+// SendResults принимает результаты нескольких задач. Результат неизвестной задачи
+// не мешает принять остальные, ее идентификатор возвращается в unknown_ids.
+func (s *OrchestratorGRPCServer) SendResults(ctx context.Context, in *pb.SendResultsRequest) (*pb.SendResultsResponse, error) {
+	res := &pb.SendResultsResponse{}
+	for _, result := range in.Results {
+		err := calculator.PostTaskResult(resultFromProto(result))
+		if err == ErrNotFound {
+			res.UnknownIds = append(res.UnknownIds, result.Id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// streamRecheckInterval — как часто поток задач проверяет очередь без уведомлений,
+// чтобы выдать задачи, аренда которых истекла.
+const streamRecheckInterval = time.Second
+
+// StreamTasks выдает задачи агенту в потоке, пока у него есть свободные места.
+// Задачи отправляются, как только появляются в очереди, а результаты принимаются
+// в том же потоке.
+func (s *OrchestratorGRPCServer) StreamTasks(stream pb.OrchestratorService_StreamTasksServer) error {
+	ctx := stream.Context()
+	agentID := agentIDFromContext(ctx)
+	messages := make(chan *pb.AgentMessage)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	recheck := time.NewTicker(streamRecheckInterval)
+	defer recheck.Stop()
+	free := 0
+	for {
+		ready := calculator.TasksReady()
+		for free > 0 {
+			task, err := calculator.GetTaskForAgent(agentID)
+			if err == ErrNotFound {
+				break
+			}
+			if err != nil {
+				return status.Errorf(codes.Unknown, "failed to get task: %v", err)
+			}
+			if err := stream.Send(taskToProto(task.Task)); err != nil {
+				return err
+			}
+			free--
+		}
+
+		select {
+		case msg := <-messages:
+			free += int(msg.FreeSlots)
+			if msg.Result != nil {
+				err := calculator.PostTaskResult(resultFromProto(msg.Result))
+				if err == ErrNotFound {
+					log.Printf("Result of unknown task %s from agent %s", msg.Result.Id, agentID)
+				} else if err != nil {
+					log.Printf("Failed to save result of task %s from agent %s: %v", msg.Result.Id, agentID, err)
+				}
+			}
+		case <-ready:
+		case <-recheck.C:
+		case err := <-recvErr:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// CancelExpression отменяет вычисление выражения. Как и в HTTP API, выражение
+// пользователя отменяется только с его токеном, а без токена — только выражения API v0.
+func (s *OrchestratorGRPCServer) CancelExpression(ctx context.Context, in *pb.CancelExpressionRequest) (*pb.Empty, error) {
+	userID := ""
+	if in.Token != "" {
+		var err error
+		userID, err = parseJWTToken(in.Token)
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid token")
+		}
+	}
+	if _, err := calculator.GetUserExpressionByID(in.Id, userID); err == ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "expression not found")
+	}
+	_, err := calculator.CancelExpression(in.Id)
+	if err == ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "expression not found")
+	}
+	if err == ErrNotRunning {
+		return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &pb.Empty{}, nil
 }
+
+func (s *OrchestratorGRPCServer) RegisterAgent(ctx context.Context, in *pb.AgentInfo) (*pb.AgentResponse, error) {
+	interval, err := calculator.RegisterAgent(agentFromInfo(in))
+	if err == ErrNoAgentID {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pb.AgentResponse{HeartbeatIntervalMs: interval.Milliseconds()}, nil
+}
+
+func (s *OrchestratorGRPCServer) Heartbeat(ctx context.Context, in *pb.AgentInfo) (*pb.AgentResponse, error) {
+	interval, err := calculator.Heartbeat(agentFromInfo(in))
+	if err == ErrNoAgentID {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pb.AgentResponse{HeartbeatIntervalMs: interval.Milliseconds()}, nil
+}
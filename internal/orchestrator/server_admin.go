@@ -0,0 +1,121 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// ErrNotAdmin возвращается, если у пользователя нет прав администратора.
+var ErrNotAdmin = errors.New("admin rights required")
+
+// isAdminUsername проверяет, указан ли логин в переменной окружения ADMIN_USERNAMES.
+// Логины администраторов перечисляются через запятую, например, "alice,bob".
+func isAdminUsername(username string) bool {
+	for _, admin := range strings.Split(os.Getenv("ADMIN_USERNAMES"), ",") {
+		if admin = strings.TrimSpace(admin); admin != "" && admin == username {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAdminToken проверяет JWT токен и права администратора.
+// Возвращает ErrNotAdmin, если пользователь не является администратором.
+func checkAdminToken(r *http.Request) (string, error) {
+	userID, err := checkJWTToken(r)
+	if err != nil {
+		return "", err
+	}
+	user, err := db.GetUserByID(userID)
+	if err != nil {
+		return "", err
+	}
+	if user.ID == "" || !isAdminUsername(user.Username) {
+		return "", ErrNotAdmin
+	}
+	return userID, nil
+}
+
+// writeAdminError отвечает статусом 403 для пользователя без прав администратора
+// и 401 для неверного токена. Возвращает true, если ответ был записан.
+func writeAdminError(w http.ResponseWriter, err error) bool {
+	if err == ErrNotAdmin {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return true
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return true
+	}
+	return false
+}
+
+// getSchedulerHandler обрабатывает запрос администратора на получение весов
+// пользователей и состояния их очередей задач.
+func getSchedulerHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := checkAdminToken(r)
+	if writeAdminError(w, err) {
+		return
+	}
+	res, err := calculator.GetScheduler()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// getAgentsHandler обрабатывает запрос администратора на получение списка живых агентов.
+func getAgentsHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := checkAdminToken(r)
+	if writeAdminError(w, err) {
+		return
+	}
+	res, err := calculator.GetAgents()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// setUserWeightHandler обрабатывает запрос администратора на изменение веса пользователя.
+func setUserWeightHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := checkAdminToken(r)
+	if writeAdminError(w, err) {
+		return
+	}
+	var req UserWeightRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, http.StatusText(http.StatusUnprocessableEntity), http.StatusUnprocessableEntity)
+		return
+	}
+	vars := mux.Vars(r)
+	err = calculator.SetUserWeight(vars["id"], req.Weight)
+	if err == ErrInvalidWeight {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == ErrNotFound {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,72 @@
+package orchestrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSchedulerAdminHandlers(t *testing.T) {
+	username := fmt.Sprintf("adm%d", time.Now().UnixNano()%1e9)
+	user, err := db.CreateUser(UserCreateForm{Username: username, Password: "password"})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	t.Setenv("ADMIN_USERNAMES", "root, "+username)
+	adminToken, _ := GenerateJWTToken(user.ID, username)
+	router := NewRouter()
+
+	send := func(method, url, token string, body any) *httptest.ResponseRecorder {
+		reqBody, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, url, bytes.NewBuffer(reqBody))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send("GET", "/api/v1/admin/scheduler", "", nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %v without a token, got %v", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := send("GET", "/api/v1/admin/scheduler", generateTestToken(), nil); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %v for a regular user, got %v", http.StatusForbidden, rr.Code)
+	}
+
+	url := "/api/v1/admin/users/" + user.ID + "/weight"
+	if rr := send("PUT", url, adminToken, UserWeightRequest{Weight: 3}); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status %v, got %v", http.StatusNoContent, rr.Code)
+	}
+	if rr := send("PUT", url, adminToken, UserWeightRequest{Weight: 0}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %v for weight 0, got %v", http.StatusBadRequest, rr.Code)
+	}
+	if rr := send("PUT", "/api/v1/admin/users/no-such-user/weight", adminToken, UserWeightRequest{Weight: 2}); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %v for an unknown user, got %v", http.StatusNotFound, rr.Code)
+	}
+
+	rr := send("GET", "/api/v1/admin/scheduler", adminToken, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %v, got %v", http.StatusOK, rr.Code)
+	}
+	var res SchedulerResponse
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	found := false
+	for _, u := range res.Users {
+		if u.UserID == user.ID {
+			found = true
+			if u.Username != username || u.Weight != 3 {
+				t.Errorf("unexpected user: %+v", u)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("user %s not found in %+v", user.ID, res.Users)
+	}
+}
@@ -2,16 +2,23 @@
 package orchestrator
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	pb "github.com/denis-gr/GOCACL_DISTRIBUTED/internal/gen"
+	"github.com/denis-gr/GOCACL_DISTRIBUTED/pkg/calc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func generateTestToken() string {
@@ -68,6 +75,99 @@ func TestCalculateHandler(t *testing.T) {
 	}
 }
 
+func TestCalculateHandlerIdempotencyKey(t *testing.T) {
+	router := NewRouter()
+	send := func(key string) (int, CalculateResponse) {
+		reqBody, _ := json.Marshal(CalculateRequest{Expression: "3+3"})
+		req, _ := http.NewRequest("POST", "/api/v1/calculate", bytes.NewBuffer(reqBody))
+		req.Header.Set("Authorization", "Bearer "+generateTestToken())
+		req.Header.Set("Idempotency-Key", key)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var res CalculateResponse
+		json.NewDecoder(rr.Body).Decode(&res)
+		return rr.Code, res
+	}
+
+	key := "handler-key-" + time.Now().Format(time.RFC3339Nano)
+	code, first := send(key)
+	if code != http.StatusOK || first.ID == "" {
+		t.Fatalf("unexpected response: %v %+v", code, first)
+	}
+	code, second := send(key)
+	if code != http.StatusOK || second.ID != first.ID {
+		t.Errorf("expected %s for a repeated key, got %v %+v", first.ID, code, second)
+	}
+	if code, _ := send(strings.Repeat("k", maxIdempotencyKeyLength+1)); code != http.StatusBadRequest {
+		t.Errorf("expected status %v for a long key, got %v", http.StatusBadRequest, code)
+	}
+}
+
+func TestCalculateHandlerRateLimit(t *testing.T) {
+	t.Setenv("QUOTA_SUBMISSIONS_PER_MINUTE", "1")
+	oldCalculator := calculator
+	calculator = NewDistributedCalculator(db)
+	defer func() { calculator = oldCalculator }()
+	router := NewRouter()
+	send := func() *httptest.ResponseRecorder {
+		reqBody, _ := json.Marshal(CalculateRequest{Expression: "2+2"})
+		req, _ := http.NewRequest("POST", "/api/v1/calculate", bytes.NewBuffer(reqBody))
+		req.Header.Set("Authorization", "Bearer "+generateTestToken())
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send(); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %v, got %v", http.StatusOK, rr.Code)
+	}
+	rr := send()
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %v, got %v", http.StatusTooManyRequests, rr.Code)
+	}
+	if retryAfter := rr.Header().Get("Retry-After"); retryAfter == "" || retryAfter == "0" {
+		t.Errorf("expected a positive Retry-After, got %q", retryAfter)
+	}
+	var errRes QuotaErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&errRes); err != nil || errRes.Limit != LimitSubmissionsPerMinute || errRes.Max != 1 {
+		t.Errorf("unexpected error response: %+v, %v", errRes, err)
+	}
+
+	req, _ := http.NewRequest("GET", "/api/v1/me/usage", nil)
+	req.Header.Set("Authorization", "Bearer "+generateTestToken())
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var usage UsageResponse
+	if err := json.NewDecoder(rr.Body).Decode(&usage); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if rr.Code != http.StatusOK || usage.SubmissionsLastMinute != 1 || usage.SubmissionsPerMinuteLimit != 1 || usage.RunningExpressions != 1 {
+		t.Errorf("unexpected usage: %v %+v", rr.Code, usage)
+	}
+}
+
+func TestCalculateHandlerOperationsLimit(t *testing.T) {
+	t.Setenv("QUOTA_OPERATIONS_PER_EXPRESSION", "1")
+	router := NewRouter()
+	reqBody, _ := json.Marshal(CalculateRequest{Expression: "1+2+3"})
+	req, _ := http.NewRequest("POST", "/api/v1/calculate", bytes.NewBuffer(reqBody))
+	req.Header.Set("Authorization", "Bearer "+generateTestToken())
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	// Повтор не поможет, поэтому 400 без Retry-After, а не 429
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %v, got %v", http.StatusBadRequest, rr.Code)
+	}
+	if retryAfter := rr.Header().Get("Retry-After"); retryAfter != "" {
+		t.Errorf("expected no Retry-After, got %q", retryAfter)
+	}
+	var errRes QuotaErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&errRes); err != nil || errRes.Limit != LimitOperationsPerExpression || errRes.Max != 1 {
+		t.Errorf("unexpected error response: %+v, %v", errRes, err)
+	}
+}
+
 func TestGetExpressionsHandler(t *testing.T) {
 	router := NewRouter()
 	req, _ := http.NewRequest("GET", "/api/v1/expressions", nil)
@@ -119,6 +219,304 @@ func TestGetExpressionByIDHandler(t *testing.T) {
 	}
 }
 
+func TestExpressionsIsolatedByUser(t *testing.T) {
+	router := NewRouter()
+	owner, _ := GenerateJWTToken("isolation-owner", "owner")
+	other, _ := GenerateJWTToken("isolation-other", "other")
+
+	reqBody, _ := json.Marshal(CalculateRequest{Expression: "2+2"})
+	req, _ := http.NewRequest("POST", "/api/v1/calculate", bytes.NewBuffer(reqBody))
+	req.Header.Set("Authorization", "Bearer "+owner)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var createRes CalculateResponse
+	if err := json.NewDecoder(rr.Body).Decode(&createRes); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+
+	// Чужое выражение не должно быть доступно по идентификатору
+	req, _ = http.NewRequest("GET", "/api/v1/expressions/"+createRes.ID, nil)
+	req.Header.Set("Authorization", "Bearer "+other)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %v, got %v", http.StatusNotFound, rr.Code)
+	}
+
+	req, _ = http.NewRequest("GET", "/api/v1/expressions/"+createRes.ID, nil)
+	req.Header.Set("Authorization", "Bearer "+owner)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %v, got %v", http.StatusOK, rr.Code)
+	}
+
+	// Выражение пользователя не должно быть доступно через API v0
+	req, _ = http.NewRequest("GET", "/api/v0/expressions/"+createRes.ID, nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %v, got %v", http.StatusNotFound, rr.Code)
+	}
+	req, _ = http.NewRequest("GET", "/api/v0/expressions", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var v0Res ExpressionsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&v0Res); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	for _, expr := range v0Res.Expressions {
+		if expr.ID == createRes.ID {
+			t.Errorf("expected expression %s to be hidden from API v0", createRes.ID)
+		}
+	}
+
+	for token, want := range map[string]int{owner: 1, other: 0} {
+		req, _ = http.NewRequest("GET", "/api/v1/expressions", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var res ExpressionsResponse
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatalf("error decoding response: %v", err)
+		}
+		if len(res.Expressions) != want {
+			t.Errorf("expected %d expressions, got %d", want, len(res.Expressions))
+		}
+		if want > 0 && res.Expressions[0].ID != createRes.ID {
+			t.Errorf("expected expression %s, got %s", createRes.ID, res.Expressions[0].ID)
+		}
+	}
+}
+
+func TestCancelExpressionHandler(t *testing.T) {
+	router := NewRouter()
+	owner, _ := GenerateJWTToken("cancel-owner", "owner")
+	other, _ := GenerateJWTToken("cancel-other", "other")
+
+	reqBody, _ := json.Marshal(CalculateRequest{Expression: "(1+2)*(3+4)"})
+	req, _ := http.NewRequest("POST", "/api/v1/calculate", bytes.NewBuffer(reqBody))
+	req.Header.Set("Authorization", "Bearer "+owner)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var createRes CalculateResponse
+	if err := json.NewDecoder(rr.Body).Decode(&createRes); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+
+	for _, test := range []struct {
+		token string
+		code  int
+	}{
+		{other, http.StatusNotFound},
+		{owner, http.StatusOK},
+		{owner, http.StatusConflict},
+	} {
+		req, _ = http.NewRequest("DELETE", "/api/v1/expressions/"+createRes.ID, nil)
+		req.Header.Set("Authorization", "Bearer "+test.token)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != test.code {
+			t.Errorf("expected status %v, got %v", test.code, rr.Code)
+		}
+	}
+
+	res, _ := calculator.GetExpressionByID(createRes.ID)
+	if res.Expression.Status != "cancelled" {
+		t.Errorf("expected status cancelled, got %q", res.Expression.Status)
+	}
+}
+
+func TestExpressionEventsHandler(t *testing.T) {
+	server := httptest.NewServer(NewRouter())
+	defer server.Close()
+	token, _ := GenerateJWTToken("events-owner", "owner")
+	// Отдельный вычислитель, чтобы задачи других тестов не мешали
+	saved := calculator
+	calculator = NewDistributedCalculator(db)
+	defer func() { calculator = saved }()
+
+	res, err := calculator.Calculate("events-owner", CalculateRequest{Expression: "2+2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/api/v1/expressions/"+res.ID+"/events", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected response: %v %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// Агент забирает задачу и возвращает результат, пока поток открыт
+	lines := bufio.NewScanner(resp.Body)
+	readEvent := func() Event {
+		var event Event
+		for lines.Scan() {
+			line := lines.Text()
+			if strings.HasPrefix(line, "data: ") {
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+					t.Fatalf("error decoding event: %v", err)
+				}
+				return event
+			}
+		}
+		t.Fatalf("stream closed: %v", lines.Err())
+		return event
+	}
+	if event := readEvent(); event.Type != EventExpression || event.Expression.Status != "running" {
+		t.Fatalf("unexpected first event: %+v", event)
+	}
+
+	task, err := calculator.GetTask()
+	if err != nil {
+		t.Fatalf("expected a task, got %v", err)
+	}
+	calculator.PostTaskResult(TaskResultRequest{ID: task.Task.ID, Result: 4})
+
+	want := []string{EventTaskLeased, EventTaskCompleted, EventExpression}
+	for _, eventType := range want {
+		event := readEvent()
+		if event.Type != eventType || event.Expression.ID != res.ID {
+			t.Errorf("expected %s event, got %+v", eventType, event)
+		}
+	}
+	if lines.Scan() && strings.HasPrefix(lines.Text(), "data: ") {
+		t.Errorf("expected the stream to be closed after the result")
+	}
+
+	// Чужой пользователь не может подписаться на выражение
+	other, _ := GenerateJWTToken("events-other", "other")
+	req, _ = http.NewRequest("GET", server.URL+"/api/v1/expressions/"+res.ID+"/events", nil)
+	req.Header.Set("Authorization", "Bearer "+other)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status %v, got %v", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func TestGetExpressionByIDHandlerWait(t *testing.T) {
+	router := NewRouter()
+	token, _ := GenerateJWTToken("wait-owner", "owner")
+	res, err := calculator.Calculate("wait-owner", CalculateRequest{Expression: "2+2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Истекшее ожидание возвращает текущее состояние
+	req, _ := http.NewRequest("GET", "/api/v1/expressions/"+res.ID+"?wait=10ms", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var got ExpressionResponse
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if rr.Code != http.StatusOK || got.Expression.Status != "running" {
+		t.Errorf("unexpected response: %v %+v", rr.Code, got.Expression)
+	}
+
+	// Ответ приходит сразу после завершения вычисления, а не по истечении ожидания
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		calculator.CancelExpression(res.ID)
+	}()
+	start := time.Now()
+	req, _ = http.NewRequest("GET", "/api/v1/expressions/"+res.ID+"?wait=30s", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if got.Expression.Status != "cancelled" || time.Since(start) > 10*time.Second {
+		t.Errorf("unexpected response after %v: %+v", time.Since(start), got.Expression)
+	}
+
+	for wait, code := range map[string]int{"abc": http.StatusBadRequest, "-1s": http.StatusBadRequest, "1": http.StatusOK,
+		"10000000000": http.StatusOK, "-10000000000": http.StatusBadRequest} {
+		req, _ = http.NewRequest("GET", "/api/v1/expressions/"+res.ID+"?wait="+wait, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != code {
+			t.Errorf("wait=%s: expected status %v, got %v", wait, code, rr.Code)
+		}
+	}
+
+	other, _ := GenerateJWTToken("wait-other", "other")
+	req, _ = http.NewRequest("GET", "/api/v1/expressions/"+res.ID+"?wait=1s", nil)
+	req.Header.Set("Authorization", "Bearer "+other)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %v, got %v", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestCalculateBatchHandler(t *testing.T) {
+	router := NewRouter()
+	token, _ := GenerateJWTToken("batch-owner", "owner")
+
+	reqBody, _ := json.Marshal([]CalculateRequest{{Expression: "2+2", Label: "row-1"}, {Expression: "3*3", Label: "row-2"}})
+	req, _ := http.NewRequest("POST", "/api/v1/calculate/batch", bytes.NewBuffer(reqBody))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %v, got %v", http.StatusOK, rr.Code)
+	}
+	var res BatchCalculateResponse
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if len(res.IDs) != 2 {
+		t.Fatalf("expected 2 ids, got %d", len(res.IDs))
+	}
+
+	req, _ = http.NewRequest("GET", "/api/v1/batches/"+res.BatchID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var batch BatchResponse
+	if err := json.NewDecoder(rr.Body).Decode(&batch); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if rr.Code != http.StatusOK || batch.Total != 2 || batch.Expressions[0].Label != "row-1" || batch.Expressions[1].ID != res.IDs[1] {
+		t.Errorf("unexpected response: %v %+v", rr.Code, batch)
+	}
+
+	other, _ := GenerateJWTToken("batch-other", "other")
+	req, _ = http.NewRequest("GET", "/api/v1/batches/"+res.BatchID, nil)
+	req.Header.Set("Authorization", "Bearer "+other)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %v, got %v", http.StatusNotFound, rr.Code)
+	}
+
+	reqBody, _ = json.Marshal([]CalculateRequest{{Expression: "2+2"}, {Expression: "2+"}})
+	req, _ = http.NewRequest("POST", "/api/v1/calculate/batch", bytes.NewBuffer(reqBody))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var errRes BatchErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&errRes); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if rr.Code != http.StatusBadRequest || errRes.Index != 1 || errRes.Error == nil || errRes.Error.Code != calc.ErrCodeUnexpectedEnd {
+		t.Errorf("unexpected response: %v %+v", rr.Code, errRes)
+	}
+}
+
 func TestGetTaskHandler(t *testing.T) {
 	conn, err := grpc.Dial("localhost:8092", grpc.WithInsecure())
 	if err != nil {
@@ -162,6 +560,174 @@ func TestPostTaskResultHandler(t *testing.T) {
 	}
 }
 
+func TestRegisterAgentGRPC(t *testing.T) {
+	conn, err := grpc.Dial("localhost:8092", grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("failed to connect to gRPC server: %v", err)
+	}
+	defer conn.Close()
+
+	client := pb.NewOrchestratorServiceClient(conn)
+	info := &pb.AgentInfo{AgentId: "grpc-agent", Hostname: "host", Version: "1.0", Capacity: 2, Operations: []string{"+"}}
+	res, err := client.RegisterAgent(context.Background(), info)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if res.HeartbeatIntervalMs <= 0 {
+		t.Errorf("expected a positive heartbeat interval, got %d", res.HeartbeatIntervalMs)
+	}
+	if _, err := client.Heartbeat(context.Background(), info); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.RegisterAgent(context.Background(), &pb.AgentInfo{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument, got %v", err)
+	}
+
+	// Задача выдается зарегистрированному агенту по идентификатору из метаданных
+	calculator.Calculate("", CalculateRequest{Expression: "5+5"})
+	ctx := metadata.AppendToOutgoingContext(context.Background(), agentIDMetadata, "grpc-agent")
+	task, err := client.GetTask(ctx, &pb.Empty{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	calculator.mu.Lock()
+	owner := calculator.taskAgents[task.Task.Id]
+	calculator.mu.Unlock()
+	if owner != "grpc-agent" {
+		t.Errorf("expected the task to be leased by grpc-agent, got %q", owner)
+	}
+	client.SendResult(context.Background(), &pb.TaskResultRequest{Id: task.Task.Id, Result: 10})
+}
+
+func TestStreamTasksGRPC(t *testing.T) {
+	oldCalculator := calculator
+	calculator = NewDistributedCalculator(db)
+	defer func() { calculator = oldCalculator }()
+
+	conn, err := grpc.Dial("localhost:8092", grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("failed to connect to gRPC server: %v", err)
+	}
+	defer conn.Close()
+	client := pb.NewOrchestratorServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, agentIDMetadata, "stream-agent")
+	stream, err := client.StreamTasks(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := stream.Send(&pb.AgentMessage{FreeSlots: 1}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Задача приходит сразу после создания выражения, без опроса
+	res, _ := calculator.Calculate("", CalculateRequest{Expression: "(1+2)*4"})
+	task, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("expected a task, got %v", err)
+	}
+	if task.Operation != "+" {
+		t.Errorf("expected task +, got %s", task.Operation)
+	}
+	// Следующая задача приходит только после освобождения места
+	if err := stream.Send(&pb.AgentMessage{FreeSlots: 1, Result: &pb.TaskResultRequest{Id: task.Id, Result: 3}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	task, err = stream.Recv()
+	if err != nil || task.Operation != "*" || task.Arg1 != 3 {
+		t.Fatalf("expected task 3*4, got %+v, %v", task, err)
+	}
+	stream.Send(&pb.AgentMessage{Result: &pb.TaskResultRequest{Id: task.Id, Result: 12}})
+
+	expr, err := calculator.WaitExpression(ctx, res.ID, "")
+	if err != nil || expr.Expression.Status != "ok" || expr.Expression.Result != 12 {
+		t.Errorf("expected result 12, got %+v, %v", expr.Expression, err)
+	}
+	stream.CloseSend()
+}
+
+func TestGetTasksGRPC(t *testing.T) {
+	oldCalculator := calculator
+	calculator = NewDistributedCalculator(db)
+	defer func() { calculator = oldCalculator }()
+
+	conn, err := grpc.Dial("localhost:8092", grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("failed to connect to gRPC server: %v", err)
+	}
+	defer conn.Close()
+	client := pb.NewOrchestratorServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, _ := calculator.Calculate("", CalculateRequest{Expression: "(1+2)*(3+4)"})
+	tasks, err := client.GetTasks(ctx, &pb.GetTasksRequest{MaxCount: 5})
+	if err != nil || len(tasks.Tasks) != 2 {
+		t.Fatalf("expected 2 tasks, got %+v, %v", tasks, err)
+	}
+	results := &pb.SendResultsRequest{Results: []*pb.TaskResultRequest{{Id: "unknown-task"}}}
+	for _, task := range tasks.Tasks {
+		results.Results = append(results.Results, &pb.TaskResultRequest{Id: task.Id, Result: task.Arg1 + task.Arg2})
+	}
+	sent, err := client.SendResults(ctx, results)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(sent.UnknownIds) != 1 || sent.UnknownIds[0] != "unknown-task" {
+		t.Errorf("expected unknown-task to be reported, got %v", sent.UnknownIds)
+	}
+
+	tasks, err = client.GetTasks(ctx, &pb.GetTasksRequest{MaxCount: 5})
+	if err != nil || len(tasks.Tasks) != 1 || tasks.Tasks[0].Operation != "*" {
+		t.Fatalf("expected task 3*7, got %+v, %v", tasks, err)
+	}
+	client.SendResults(ctx, &pb.SendResultsRequest{Results: []*pb.TaskResultRequest{{Id: tasks.Tasks[0].Id, Result: 21}}})
+	expr, err := calculator.WaitExpression(ctx, res.ID, "")
+	if err != nil || expr.Expression.Result != 21 {
+		t.Errorf("expected result 21, got %+v, %v", expr.Expression, err)
+	}
+
+	// Пустая очередь — это пустой список, а не ошибка
+	tasks, err = client.GetTasks(ctx, &pb.GetTasksRequest{MaxCount: 5})
+	if err != nil || len(tasks.Tasks) != 0 {
+		t.Errorf("expected no tasks, got %+v, %v", tasks, err)
+	}
+}
+
+func TestCancelExpressionGRPC(t *testing.T) {
+	conn, err := grpc.Dial("localhost:8092", grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("failed to connect to gRPC server: %v", err)
+	}
+	defer conn.Close()
+	client := pb.NewOrchestratorServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	owner, _ := GenerateJWTToken("grpc-cancel-owner", "owner")
+	other, _ := GenerateJWTToken("grpc-cancel-other", "other")
+	res, _ := calculator.Calculate("grpc-cancel-owner", CalculateRequest{Expression: "2+2"})
+
+	// Чужое выражение нельзя отменить ни без токена, ни с чужим токеном
+	for _, token := range []string{"", other} {
+		_, err := client.CancelExpression(ctx, &pb.CancelExpressionRequest{Id: res.ID, Token: token})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("expected NotFound, got %v", err)
+		}
+	}
+	if _, err := client.CancelExpression(ctx, &pb.CancelExpressionRequest{Id: res.ID, Token: "invalid"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated, got %v", err)
+	}
+	if _, err := client.CancelExpression(ctx, &pb.CancelExpressionRequest{Id: res.ID, Token: owner}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if expr, _ := calculator.GetExpressionByID(res.ID); expr.Expression.Status != "cancelled" {
+		t.Errorf("expected status cancelled, got %q", expr.Expression.Status)
+	}
+}
+
 func TestCalculateHandlerInvalidRequest(t *testing.T) {
 	router := NewRouter()
 	req, _ := http.NewRequest("POST", "/api/v1/calculate", bytes.NewBuffer([]byte("invalid")))
@@ -174,6 +740,27 @@ func TestCalculateHandlerInvalidRequest(t *testing.T) {
 	}
 }
 
+func TestCalculateHandlerSyntaxError(t *testing.T) {
+	router := NewRouter()
+	reqBody, _ := json.Marshal(CalculateRequest{Expression: "2+(3*"})
+	req, _ := http.NewRequest("POST", "/api/v1/calculate", bytes.NewBuffer(reqBody))
+	req.Header.Set("Authorization", "Bearer "+generateTestToken())
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %v, got %v", http.StatusBadRequest, rr.Code)
+	}
+	var res ParseErrorResponse
+	err := json.NewDecoder(rr.Body).Decode(&res)
+	if err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if res.Error == nil || res.Error.Code != calc.ErrCodeUnexpectedEnd || res.Error.Offset != 5 {
+		t.Errorf("unexpected error: %+v", res.Error)
+	}
+}
+
 func TestPostTaskResultHandlerInvalidRequest(t *testing.T) {
 	conn, err := grpc.Dial("localhost:8092", grpc.WithInsecure())
 	if err != nil {
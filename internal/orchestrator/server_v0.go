@@ -15,8 +15,10 @@ func calculateHandlerV0(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusUnprocessableEntity), http.StatusUnprocessableEntity)
 		return
 	}
-	res, _ := calculator.Calculate(req)
-	_, err := db.CreateExpressionWithId("", res.ID, CalculateRequest{Expression: req.Expression})
+	res, err := calculator.Calculate("", req)
+	if writeParseError(w, err) || writeQuotaError(w, err) {
+		return
+	}
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
@@ -42,7 +44,8 @@ func getExpressionsHandlerV0(w http.ResponseWriter, _ *http.Request) {
 func getExpressionByIDHandlerV0(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
-	res, err := calculator.GetExpressionByID(id)
+	// Выражения пользователей API v1 через API v0 недоступны
+	res, err := calculator.GetUserExpressionByID(id, "")
 	if err == ErrNotFound {
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
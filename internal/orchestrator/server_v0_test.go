@@ -29,6 +29,29 @@ func TestCalculateHandlerV0(t *testing.T) {
 	}
 }
 
+func TestCalculateHandlerV0RateLimit(t *testing.T) {
+	t.Setenv("QUOTA_SUBMISSIONS_PER_MINUTE", "1")
+	oldCalculator := calculator
+	calculator = NewDistributedCalculator(db)
+	defer func() { calculator = oldCalculator }()
+	router := NewRouter()
+	send := func() int {
+		reqBody, _ := json.Marshal(CalculateRequest{Expression: "2+2"})
+		req, _ := http.NewRequest("POST", "/api/v0/calculate", bytes.NewBuffer(reqBody))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// Ограничение API v0 общее для всех анонимных запросов
+	if code := send(); code != http.StatusOK {
+		t.Fatalf("expected status %v, got %v", http.StatusOK, code)
+	}
+	if code := send(); code != http.StatusTooManyRequests {
+		t.Errorf("expected status %v, got %v", http.StatusTooManyRequests, code)
+	}
+}
+
 func TestGetExpressionsHandlerV0(t *testing.T) {
 	router := NewRouter()
 	req, _ := http.NewRequest("GET", "/api/v0/expressions", nil)
@@ -0,0 +1,244 @@
+package calc
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Node представляет вершину синтаксического дерева выражения.
+type Node interface {
+	// Eval вычисляет значение поддерева, используя функции из Operations.
+	Eval(ops *Operations) (float64, error)
+	// String возвращает каноническую инфиксную запись поддерева.
+	String() string
+}
+
+// Number — числовая константа.
+type Number struct {
+	Value float64
+	Text  string // Исходная запись числа без потери точности, может быть пустой
+	Pos   int    // Смещение числа в байтах от начала выражения
+}
+
+// Variable — именованная переменная или встроенная константа.
+type Variable struct {
+	Name string
+	Pos  int
+}
+
+// Unary — унарный минус.
+type Unary struct {
+	Op      string // Всегда "-"
+	Operand Node
+	Pos     int
+}
+
+// Binary — бинарная операция: +, -, *, /, % или ^.
+type Binary struct {
+	Op          string
+	Left, Right Node
+	Pos         int // Смещение оператора
+}
+
+// Call — вызов функции.
+type Call struct {
+	Name string
+	Args []Node
+	Pos  int // Смещение имени функции
+}
+
+// Parse разбирает выражение и возвращает корень его синтаксического дерева.
+// Проверяется только синтаксис: существование функций и переменных
+// проверяется при вычислении или построении графа.
+// Возвращает *ParseError, если выражение некорректно.
+// Пример: "2+3*x" -> Binary{"+", Number{2}, Binary{"*", Number{3}, Variable{"x"}}}
+func Parse(expression string) (Node, error) {
+	rpn, err := toRPN(splitExpression(expression))
+	if err != nil {
+		return nil, err
+	}
+	stack := make([]Node, 0, len(rpn))
+
+	for _, tok := range rpn {
+		switch {
+		case isBinaryOperator(tok.text):
+			left, right := stack[len(stack)-2], stack[len(stack)-1]
+			stack = stack[:len(stack)-2]
+			stack = append(stack, &Binary{Op: tok.text, Left: left, Right: right, Pos: tok.pos})
+		case tok.text == "~":
+			operand := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			stack = append(stack, &Unary{Op: "-", Operand: operand, Pos: tok.pos})
+		case isNumber(tok.text):
+			value, _ := strconv.ParseFloat(tok.text, 64)
+			stack = append(stack, &Number{Value: value, Text: tok.text, Pos: tok.pos})
+		default:
+			if name, argc, ok := parseCallToken(tok.text); ok {
+				args := append([]Node(nil), stack[len(stack)-argc:]...)
+				stack = stack[:len(stack)-argc]
+				stack = append(stack, &Call{Name: name, Args: args, Pos: tok.pos})
+				break
+			}
+			stack = append(stack, &Variable{Name: tok.text, Pos: tok.pos})
+		}
+	}
+
+	return stack[0], nil
+}
+
+// Eval возвращает значение числа. Число вне диапазона float64 некорректно.
+func (n *Number) Eval(ops *Operations) (float64, error) {
+	if math.IsInf(n.Value, 0) {
+		return 0, newParseError(ErrCodeInvalidNumber, token{text: n.Text, pos: n.Pos})
+	}
+	return n.Value, nil
+}
+
+// Eval возвращает значение переменной или константы.
+func (n *Variable) Eval(ops *Operations) (float64, error) {
+	value, ok := ops.lookupVariable(n.Name)
+	if !ok {
+		return 0, newParseError(ErrCodeUnknownVariable, token{text: n.Name, pos: n.Pos})
+	}
+	return value, nil
+}
+
+// Eval вычисляет значение операнда и меняет его знак.
+func (n *Unary) Eval(ops *Operations) (float64, error) {
+	a, err := n.Operand.Eval(ops)
+	if err != nil {
+		return 0, err
+	}
+	return ops.NegateFunc(a), nil
+}
+
+// Eval вычисляет значения операндов и применяет к ним операцию.
+func (n *Binary) Eval(ops *Operations) (float64, error) {
+	a, err := n.Left.Eval(ops)
+	if err != nil {
+		return 0, err
+	}
+	b, err := n.Right.Eval(ops)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n.Op {
+	case "+":
+		return ops.PlusFunc(a, b), nil
+	case "-":
+		return ops.MinusFunc(a, b), nil
+	case "*":
+		return ops.MultiplyFunc(a, b), nil
+	case "/":
+		if b == 0 {
+			return 0, ErrDivisionByZero
+		}
+		return ops.DivideFunc(a, b), nil
+	case "%":
+		if b == 0 {
+			return 0, ErrDivisionByZero
+		}
+		return ops.ModuloFunc(a, b), nil
+	case "^":
+		return ops.PowerFunc(a, b), nil
+	}
+	return 0, newParseError(ErrCodeUnexpectedCharacter, token{text: n.Op, pos: n.Pos})
+}
+
+// Eval вычисляет значения аргументов и вызывает функцию.
+func (n *Call) Eval(ops *Operations) (float64, error) {
+	function, err := ops.lookupFunction(n)
+	if err != nil {
+		return 0, err
+	}
+	args := make([]float64, len(n.Args))
+	for i, arg := range n.Args {
+		if args[i], err = arg.Eval(ops); err != nil {
+			return 0, err
+		}
+	}
+	return function.Func(args...), nil
+}
+
+// lookupFunction находит функцию для вызова и проверяет число аргументов.
+func (ops *Operations) lookupFunction(n *Call) (Function, error) {
+	nameToken := token{text: n.Name, pos: n.Pos}
+	function, ok := ops.Functions[n.Name]
+	if !ok {
+		return Function{}, newParseError(ErrCodeUnknownFunction, nameToken)
+	}
+	argc := len(n.Args)
+	if argc < function.MinArgs || (function.MaxArgs >= 0 && argc > function.MaxArgs) {
+		return Function{}, newParseError(ErrCodeArgumentCount, nameToken)
+	}
+	return function, nil
+}
+
+// String возвращает запись числа без экспоненты, чтобы ее можно было разобрать снова.
+// Отрицательное число заключается в скобки, а число вне диапазона float64
+// записывается так же, как в выражении.
+func (n *Number) String() string {
+	if math.IsInf(n.Value, 0) {
+		return n.Text
+	}
+	s := strconv.FormatFloat(n.Value, 'f', -1, 64)
+	if n.Value < 0 {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// String возвращает имя переменной.
+func (n *Variable) String() string {
+	return n.Name
+}
+
+// String возвращает запись унарного минуса.
+// Пример: -(2+3), -(-2), -2^2
+func (n *Unary) String() string {
+	if nodePrecedence(n.Operand) <= precedence("~") {
+		return n.Op + "(" + n.Operand.String() + ")"
+	}
+	return n.Op + n.Operand.String()
+}
+
+// String возвращает запись бинарной операции с минимально необходимыми скобками.
+// Пример: (1 + 2) * 3, 1 - (2 - 3), (2 ^ 3) ^ 2, 2 * (-3)
+func (n *Binary) String() string {
+	p := precedence(n.Op)
+	left, right := n.Left.String(), n.Right.String()
+	// "^" правоассоциативен, остальные операторы левоассоциативны
+	if lp := nodePrecedence(n.Left); lp < p || (lp == p && n.Op == "^") {
+		left = "(" + left + ")"
+	}
+	if _, ok := n.Right.(*Unary); ok {
+		right = "(" + right + ")"
+	} else if rp := nodePrecedence(n.Right); rp < p || (rp == p && n.Op != "^") {
+		right = "(" + right + ")"
+	}
+	return left + " " + n.Op + " " + right
+}
+
+// String возвращает запись вызова функции.
+// Пример: max(1, 2 + 3)
+func (n *Call) String() string {
+	args := make([]string, len(n.Args))
+	for i, arg := range n.Args {
+		args[i] = arg.String()
+	}
+	return n.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// nodePrecedence возвращает приоритет операции в корне поддерева.
+// Числа, переменные и вызовы функций никогда не требуют скобок.
+func nodePrecedence(node Node) int {
+	switch n := node.(type) {
+	case *Binary:
+		return precedence(n.Op)
+	case *Unary:
+		return precedence("~")
+	}
+	return precedence("^") + 1
+}
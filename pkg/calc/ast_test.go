@@ -0,0 +1,106 @@
+package calc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"2+2*(3+3*(1+2))", "2 + 2 * (3 + 3 * (1 + 2))"},
+		{"(1+2)*3", "(1 + 2) * 3"},
+		{"1-(2-3)", "1 - (2 - 3)"},
+		{"(1-2)-3", "1 - 2 - 3"},
+		{"2^3^2", "2 ^ 3 ^ 2"},
+		{"(2^3)^2", "(2 ^ 3) ^ 2"},
+		{"-2^2", "-2 ^ 2"},
+		{"(-2)^2", "(-2) ^ 2"},
+		{"--2", "-(-2)"},
+		{"-(1+2)", "-(1 + 2)"},
+		{"2*-3", "2 * (-3)"},
+		{"+x", "x"},
+		{"max( 1,2+3 ,y)", "max(1, 2 + 3, y)"},
+		{"rand()", "rand()"},
+		{"0.50*pi", "0.5 * pi"},
+	}
+	for _, test := range tests {
+		node, err := Parse(test.expression)
+		if err != nil {
+			t.Errorf("Parse(%q) returned an error: %v", test.expression, err)
+			continue
+		}
+		if got := node.String(); got != test.want {
+			t.Errorf("Parse(%q).String() = %q; want %q", test.expression, got, test.want)
+		}
+		// Каноническая запись должна разбираться в то же дерево
+		again, err := Parse(test.want)
+		if err != nil || again.String() != test.want {
+			t.Errorf("Parse(%q) is not stable: %v, %v", test.want, again, err)
+		}
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	node, err := Parse("1 + max(x, 2)")
+	if err != nil {
+		t.Fatalf("Parse returned an error: %v", err)
+	}
+	binary, ok := node.(*Binary)
+	if !ok || binary.Op != "+" || binary.Pos != 2 {
+		t.Fatalf("root = %#v; want Binary \"+\" at 2", node)
+	}
+	if number, ok := binary.Left.(*Number); !ok || number.Value != 1 || number.Pos != 0 {
+		t.Errorf("left = %#v; want Number 1 at 0", binary.Left)
+	}
+	call, ok := binary.Right.(*Call)
+	if !ok || call.Name != "max" || call.Pos != 4 || len(call.Args) != 2 {
+		t.Fatalf("right = %#v; want Call max at 4 with 2 args", binary.Right)
+	}
+	if variable, ok := call.Args[0].(*Variable); !ok || variable.Name != "x" || variable.Pos != 8 {
+		t.Errorf("first arg = %#v; want Variable x at 8", call.Args[0])
+	}
+
+	if _, err := Parse("2+"); err == nil {
+		t.Errorf("Parse(\"2+\") expected an error")
+	}
+}
+
+func TestNodeEval(t *testing.T) {
+	operations := NewOperationsDefault()
+	operations.Variables = map[string]float64{"x": 3}
+	tests := []struct {
+		node     Node
+		expected float64
+		err      error
+	}{
+		{&Number{Value: 2}, 2, nil},
+		{&Variable{Name: "x"}, 3, nil},
+		{&Unary{Op: "-", Operand: &Variable{Name: "pi"}}, -3.141592653589793, nil},
+		{&Binary{Op: "^", Left: &Number{Value: 2}, Right: &Variable{Name: "x"}}, 8, nil},
+		{&Call{Name: "max", Args: []Node{&Number{Value: 1}, &Variable{Name: "x"}}}, 3, nil},
+		{&Binary{Op: "/", Left: &Number{Value: 1}, Right: &Number{Value: 0}}, 0, ErrDivisionByZero},
+	}
+	for _, test := range tests {
+		result, err := test.node.Eval(operations)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%v: Eval() error = %v; want %v", test.node, err, test.err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("%v: Eval() = %v; want %v", test.node, result, test.expected)
+		}
+	}
+
+	var parseErr *ParseError
+	_, err := (&Call{Name: "sqrt", Pos: 5}).Eval(operations)
+	if !errors.As(err, &parseErr) || parseErr.Code != ErrCodeArgumentCount || parseErr.Offset != 5 {
+		t.Errorf("Eval() error = %v; want %s at 5", err, ErrCodeArgumentCount)
+	}
+	_, err = (&Variable{Name: "y", Pos: 1}).Eval(operations)
+	if !errors.As(err, &parseErr) || parseErr.Code != ErrCodeUnknownVariable || parseErr.Offset != 1 {
+		t.Errorf("Eval() error = %v; want %s at 1", err, ErrCodeUnknownVariable)
+	}
+}
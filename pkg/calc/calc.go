@@ -1,35 +1,96 @@
-// Package calc реализует функцию Calc, которая вычисляет значение выражения, заданного строкой.
+// Package calc реализует разбор выражений в синтаксическое дерево (Parse) и функцию Calc,
+// которая вычисляет значение выражения, заданного строкой.
 package calc
 
 import (
 	"errors"
+	"math"
+	"math/big"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
+// token представляет токен выражения и его положение в строке.
+type token struct {
+	text string
+	pos  int // Смещение первого байта токена от начала выражения
+}
+
 // splitExpression разбивает строку выражения на отдельные токены.
-// Токены могут быть числами, операторами или скобками.
+// Токены могут быть числами, идентификаторами, операторами, скобками или запятыми.
 // Пример: "2+2*(3+3*(1+2))" -> ["2", "+", "2", "*", "(", "3", "+", "3", "*", "(", "1", "+", "2", ")", ")"]
-func splitExpression(expression string) []string {
-	answer := make([]string, 0, len(expression))
-	subString := make([]string, 0, len(expression))
-	for _, v := range strings.Split(expression, "") {
-		if ((v >= "0") && (v <= "9")) || (v == ".") || (v == ",") {
-			subString = append(subString, v)
-		} else if v != " " {
-			if len(subString) > 0 {
-				answer = append(answer, strings.Join(subString, ""))
-				subString = make([]string, 0, len(expression))
-			}
-			answer = append(answer, v)
+// Пример: "max(1,x2)" -> ["max", "(", "1", ",", "x2", ")"]
+func splitExpression(expression string) []token {
+	answer := make([]token, 0, len(expression))
+	start := -1 // Начало числа или идентификатора, который еще не добавлен в answer
+	flush := func(end int) {
+		if start >= 0 {
+			answer = append(answer, token{text: expression[start:end], pos: start})
+			start = -1
 		}
 	}
-	if len(subString) > 0 {
-		answer = append(answer, strings.Join(subString, ""))
+	for i, r := range expression {
+		v := string(r)
+		switch {
+		case ((v >= "0") && (v <= "9")) || (v == "."):
+			if start < 0 {
+				start = i
+			}
+		case isLetter(v):
+			// Идентификатор не может начинаться с цифры: "2x" -> ["2", "x"]
+			if start >= 0 && !isLetter(expression[start:start+1]) {
+				flush(i)
+			}
+			if start < 0 {
+				start = i
+			}
+		default:
+			flush(i)
+			if !unicode.IsSpace(r) {
+				answer = append(answer, token{text: v, pos: i})
+			}
+		}
 	}
+	flush(len(expression))
 	return answer
 }
 
+// isLetter проверяет, может ли символ входить в имя функции или переменной.
+func isLetter(v string) bool {
+	return (v >= "a" && v <= "z") || (v >= "A" && v <= "Z") || v == "_"
+}
+
+// isNumber проверяет, является ли токен числом.
+func isNumber(token string) bool {
+	return token != "" && ((token[0] >= '0' && token[0] <= '9') || token[0] == '.')
+}
+
+// isIdentifier проверяет, является ли токен именем функции или переменной.
+func isIdentifier(token string) bool {
+	return token != "" && isLetter(token[:1])
+}
+
+// callToken возвращает токен ОПН для вызова функции с заданным числом аргументов.
+// Пример: "max", 3 -> "max(3)"
+func callToken(name string, argc int) string {
+	return name + "(" + strconv.Itoa(argc) + ")"
+}
+
+// parseCallToken разбирает токен ОПН вызова функции.
+// Пример: "max(3)" -> "max", 3, true
+func parseCallToken(token string) (string, int, bool) {
+	idx := strings.Index(token, "(")
+	if idx <= 0 || !strings.HasSuffix(token, ")") {
+		return "", 0, false
+	}
+	argc, err := strconv.Atoi(token[idx+1 : len(token)-1])
+	if err != nil {
+		return "", 0, false
+	}
+	return token[:idx], argc, true
+}
+
 // precedence возвращает приоритет оператора.
 // Операторы с более высоким приоритетом будут обработаны первыми.
 // Пример: "+" -> 1, "*" -> 2
@@ -43,43 +104,146 @@ func precedence(op string) int {
 		return 2
 	case "/":
 		return 2
+	case "%":
+		return 2
+	case "~":
+		return 3
+	case "^":
+		return 4
 	default:
 		return 0
 	}
 }
 
-// toRPN преобразует инфиксное выражение в обратную польскую нотацию (ОПН).
+// isBinaryOperator проверяет, является ли токен бинарным оператором.
+func isBinaryOperator(op string) bool {
+	return precedence(op) > 0 && op != "~"
+}
+
+// toRPN преобразует инфиксное выражение в обратную польскую нотацию (ОПН)
+// и проверяет его синтаксис.
+// Унарный минус записывается как оператор "~", унарный плюс опускается.
+// Оператор "^" правоассоциативен. Вызов функции записывается как "имя(число аргументов)".
 // Пример: ["2", "+", "2", "*", "(", "3", "+", "3", "*", "(", "1", "+", "2", ")", ")"] -> ["2", "2", "3", "3", "1", "2", "+", "*", "+", "*", "+"]
-func toRPN(expression []string) []string {
-	stack := make([]string, 0, len(expression))
-	answer := make([]string, 0, len(expression))
-	for _, v := range expression {
+// Пример: ["-", "2", "^", "2"] -> ["2", "2", "^", "~"]
+// Пример: ["max", "(", "1", ",", "2", "+", "3", ")"] -> ["1", "2", "3", "+", "max(2)"]
+func toRPN(expression []token) ([]token, error) {
+	stack := make([]token, 0, len(expression))
+	answer := make([]token, 0, len(expression))
+	commas := make([]int, 0, len(expression)) // Число запятых внутри каждой открытой скобки
+	calls := make([]bool, 0, len(expression)) // Является ли открытая скобка вызовом функции
+	expectOperand := true
+	prev := ""
+	for i, v := range expression {
 		switch {
-		case v >= "0" && v <= "9":
+		case isNumber(v.text):
+			if !expectOperand {
+				return nil, newParseError(ErrCodeUnexpectedToken, v)
+			}
+			// Числа вне диапазона float64 допустимы в точных режимах, поэтому они
+			// проверяются при построении графа или вычислении
+			if _, err := strconv.ParseFloat(v.text, 64); err != nil && !errors.Is(err, strconv.ErrRange) {
+				return nil, newParseError(ErrCodeInvalidNumber, v)
+			}
 			answer = append(answer, v)
-		case v == "(":
+			expectOperand = false
+		case isIdentifier(v.text):
+			if !expectOperand {
+				return nil, newParseError(ErrCodeUnexpectedToken, v)
+			}
+			if i+1 < len(expression) && expression[i+1].text == "(" {
+				stack = append(stack, v)
+			} else {
+				answer = append(answer, v)
+				expectOperand = false
+			}
+		case v.text == "(":
+			if !expectOperand {
+				return nil, newParseError(ErrCodeUnexpectedToken, v)
+			}
 			stack = append(stack, v)
-		case v == ")":
-			for len(stack) > 0 && stack[len(stack)-1] != "(" {
+			commas = append(commas, 0)
+			calls = append(calls, isIdentifier(prev))
+		case v.text == ",":
+			if len(calls) == 0 || !calls[len(calls)-1] {
+				return nil, newParseError(ErrCodeUnexpectedToken, v)
+			}
+			if expectOperand {
+				return nil, newParseError(ErrCodeMissingOperand, v)
+			}
+			for stack[len(stack)-1].text != "(" {
 				answer = append(answer, stack[len(stack)-1])
 				stack = stack[:len(stack)-1]
 			}
-			if len(stack) > 0 {
-				stack = stack[:len(stack)-1] // Удалить "(" из стека
+			commas[len(commas)-1]++
+			expectOperand = true
+		case v.text == ")":
+			if len(calls) == 0 {
+				return nil, newParseError(ErrCodeUnmatchedParenthesis, v)
 			}
-		default:
-			for len(stack) > 0 && precedence(stack[len(stack)-1]) >= precedence(v) {
+			isCall := calls[len(calls)-1]
+			if expectOperand && !(prev == "(" && isCall) {
+				return nil, newParseError(ErrCodeMissingOperand, v)
+			}
+			for stack[len(stack)-1].text != "(" {
+				answer = append(answer, stack[len(stack)-1])
+				stack = stack[:len(stack)-1]
+			}
+			stack = stack[:len(stack)-1] // Удалить "(" из стека
+			argc := commas[len(commas)-1] + 1
+			if prev == "(" {
+				argc = 0
+			}
+			commas = commas[:len(commas)-1]
+			calls = calls[:len(calls)-1]
+			if isCall {
+				name := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				answer = append(answer, token{text: callToken(name.text, argc), pos: name.pos})
+			}
+			expectOperand = false
+		case (v.text == "-" || v.text == "+") && expectOperand:
+			// Унарный оператор применяется к следующему операнду, поэтому
+			// ничего не выталкивает из стека
+			if v.text == "-" {
+				stack = append(stack, token{text: "~", pos: v.pos})
+			}
+		case isBinaryOperator(v.text):
+			if expectOperand {
+				return nil, newParseError(ErrCodeMissingOperand, v)
+			}
+			for len(stack) > 0 {
+				top := precedence(stack[len(stack)-1].text)
+				if top < precedence(v.text) || (top == precedence(v.text) && v.text == "^") {
+					break
+				}
 				answer = append(answer, stack[len(stack)-1])
 				stack = stack[:len(stack)-1]
 			}
 			stack = append(stack, v)
+			expectOperand = true
+		default:
+			return nil, newParseError(ErrCodeUnexpectedCharacter, v)
 		}
+		prev = v.text
+	}
+
+	if len(expression) == 0 {
+		return nil, newParseError(ErrCodeEmptyExpression, token{})
+	}
+	if expectOperand {
+		last := expression[len(expression)-1]
+		return nil, newParseError(ErrCodeUnexpectedEnd, token{pos: last.pos + len(last.text)})
 	}
 	for len(stack) > 0 {
-		answer = append(answer, stack[len(stack)-1])
+		top := stack[len(stack)-1]
+		if top.text == "(" {
+			return nil, newParseError(ErrCodeUnmatchedParenthesis, top)
+		}
+		answer = append(answer, top)
 		stack = stack[:len(stack)-1]
 	}
-	return answer
+	return answer, nil
 }
 
 // Operations содержит функции для выполнения арифметических операций.
@@ -88,6 +252,28 @@ type Operations struct {
 	MinusFunc    func(a, b float64) float64
 	MultiplyFunc func(a, b float64) float64
 	DivideFunc   func(a, b float64) float64
+	ModuloFunc   func(a, b float64) float64
+	PowerFunc    func(a, b float64) float64
+	NegateFunc   func(a float64) float64
+	Functions    map[string]Function
+	Variables    map[string]float64 // Значения переменных выражения, дополняют Constants
+	Exact        bool               // Граф строится для точного режима: числа вне диапазона float64 допустимы
+}
+
+// Constants содержит встроенные именованные константы.
+var Constants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+// lookupVariable возвращает значение переменной или встроенной константы.
+// Переменные, заданные пользователем, имеют приоритет над константами.
+func (ops *Operations) lookupVariable(name string) (float64, bool) {
+	if value, ok := ops.Variables[name]; ok {
+		return value, true
+	}
+	value, ok := Constants[name]
+	return value, ok
 }
 
 // NewOperationsDefault создает новый экземпляр Operations с функциями по умолчанию.
@@ -108,56 +294,133 @@ func NewOperationsDefault() *Operations {
 			}
 			return a / b
 		},
+		ModuloFunc: func(a, b float64) float64 {
+			if b == 0 {
+				panic("деление на ноль")
+			}
+			return math.Mod(a, b)
+		},
+		PowerFunc: func(a, b float64) float64 {
+			return math.Pow(a, b)
+		},
+		NegateFunc: func(a float64) float64 {
+			return -a
+		},
+		Functions: DefaultFunctions(),
 	}
 }
 
-// Calc вычисляет значение выражения, заданного строкой, используя функции из Operations.
-// Возвращает результат вычисления или ошибку, если выражение некорректно.
-// Пример: "2+2*(3+3*(1+2))" -> 20, nil
-func (ops *Operations) Calc(expression string) (float64, error) {
-	rpn := toRPN(splitExpression(expression))
-	stack := make([]float64, 0, len(rpn))
-	tempResult := 0.0
-
-	for _, token := range rpn {
-		switch token {
-		case "+", "-", "*", "/":
-			if len(stack) < 2 {
-				return 0, errors.New("некорректное выражение")
-			}
-			b := stack[len(stack)-1]
-			stack = stack[:len(stack)-1]
-			a := stack[len(stack)-1]
-			stack = stack[:len(stack)-1]
-
-			switch token {
-			case "+":
-				tempResult = ops.PlusFunc(a, b)
-			case "-":
-				tempResult = ops.MinusFunc(a, b)
-			case "*":
-				tempResult = ops.MultiplyFunc(a, b)
-			case "/":
-				if b == 0 {
-					return 0, errors.New("деление на ноль")
+// GraphNode представляет вершину графа зависимостей выражения.
+// Для числа заполнено поле Value, для операции — Operation и Args.
+type GraphNode struct {
+	Value     float64
+	Exact     string // Запись числа без потери точности для точных режимов
+	Operation string
+	Args      []int // Индексы вершин-операндов в Graph.Nodes
+}
+
+// Graph представляет граф зависимостей операций выражения.
+// Вершины упорядочены так, что операнды всегда стоят раньше операций над ними,
+// поэтому операции, не зависящие друг от друга, можно вычислять одновременно.
+type Graph struct {
+	Nodes []GraphNode
+	Root  int // Индекс вершины, значение которой является результатом выражения
+}
+
+// Graph строит граф зависимостей для выражения, заданного строкой.
+// Переменные и константы сразу заменяются своими значениями.
+// Возвращает *ParseError, если выражение некорректно.
+// Пример: "(1+2)*(3+4)" -> [1, 2, 1+2, 3, 4, 3+4, (1+2)*(3+4)], корень 6
+func (ops *Operations) Graph(expression string) (*Graph, error) {
+	root, err := Parse(expression)
+	if err != nil {
+		return nil, err
+	}
+	return ops.BuildGraph(root)
+}
+
+// BuildGraph строит граф зависимостей для синтаксического дерева.
+// Вершины добавляются в порядке обхода дерева в глубину: сначала операнды, затем операция.
+// Унарный минус записывается в графе как операция "~".
+// Возвращает *ParseError, если в дереве есть неизвестная функция или переменная.
+func (ops *Operations) BuildGraph(root Node) (*Graph, error) {
+	graph := &Graph{}
+	var err error
+	var add func(node Node) (int, error)
+	add = func(node Node) (int, error) {
+		var graphNode GraphNode
+		switch n := node.(type) {
+		case *Number:
+			graphNode.Value = n.Value
+			if math.IsInf(n.Value, 0) {
+				// Число вне диапазона float64 допустимо только в точном режиме,
+				// а в вершине сохраняется его ближайшее конечное значение
+				x, ok := new(big.Rat).SetString(n.Text)
+				if !ops.Exact || !ok {
+					return 0, newParseError(ErrCodeInvalidNumber, token{text: n.Text, pos: n.Pos})
 				}
-				tempResult = ops.DivideFunc(a, b)
+				graphNode.Value = ExactToFloat(x)
 			}
-			stack = append(stack, tempResult)
-		default:
-			value, err := strconv.ParseFloat(token, 64)
+			graphNode.Exact = n.Text
+			if graphNode.Exact == "" {
+				graphNode.Exact = strconv.FormatFloat(n.Value, 'f', -1, 64)
+			}
+		case *Variable:
+			value, err := n.Eval(ops)
+			if err != nil {
+				return 0, err
+			}
+			graphNode.Value = value
+			graphNode.Exact = strconv.FormatFloat(value, 'f', -1, 64)
+		case *Unary:
+			a, err := add(n.Operand)
+			if err != nil {
+				return 0, err
+			}
+			graphNode = GraphNode{Operation: "~", Args: []int{a}}
+		case *Binary:
+			a, err := add(n.Left)
 			if err != nil {
-				return 0, errors.New("некорректное число")
+				return 0, err
 			}
-			stack = append(stack, value)
+			b, err := add(n.Right)
+			if err != nil {
+				return 0, err
+			}
+			graphNode = GraphNode{Operation: n.Op, Args: []int{a, b}}
+		case *Call:
+			if _, err := ops.lookupFunction(n); err != nil {
+				return 0, err
+			}
+			args := make([]int, len(n.Args))
+			for i, arg := range n.Args {
+				idx, err := add(arg)
+				if err != nil {
+					return 0, err
+				}
+				args[i] = idx
+			}
+			graphNode = GraphNode{Operation: n.Name, Args: args}
 		}
+		graph.Nodes = append(graph.Nodes, graphNode)
+		return len(graph.Nodes) - 1, nil
 	}
 
-	if len(stack) != 1 {
-		return 0, errors.New("некорректное выражение")
+	if graph.Root, err = add(root); err != nil {
+		return nil, err
 	}
+	return graph, nil
+}
 
-	return stack[0], nil
+// Calc вычисляет значение выражения, заданного строкой, используя функции из Operations.
+// Возвращает результат вычисления или ошибку, если выражение некорректно.
+// Пример: "2+2*(3+3*(1+2))" -> 20, nil
+func (ops *Operations) Calc(expression string) (float64, error) {
+	root, err := Parse(expression)
+	if err != nil {
+		return 0, err
+	}
+	return root.Eval(ops)
 }
 
 // Calc вычисляет значение выражения, заданного строкой.
@@ -2,9 +2,30 @@
 package calc
 
 import (
+	"errors"
+	"math"
+	"strings"
 	"testing"
 )
 
+// tokenTexts возвращает тексты токенов.
+func tokenTexts(tokens []token) []string {
+	texts := make([]string, len(tokens))
+	for i, tok := range tokens {
+		texts[i] = tok.text
+	}
+	return texts
+}
+
+// newTokens создает токены из текстов, считая, что каждый токен занимает один байт.
+func newTokens(texts []string) []token {
+	tokens := make([]token, len(texts))
+	for i, text := range texts {
+		tokens[i] = token{text: text, pos: i}
+	}
+	return tokens
+}
+
 func TestSplitExpression(t *testing.T) {
 	cases := []struct {
 		name       string
@@ -26,11 +47,21 @@ func TestSplitExpression(t *testing.T) {
 			expression: "2+2*(3+3*(1+2))",
 			want:       []string{"2", "+", "2", "*", "(", "3", "+", "3", "*", "(", "1", "+", "2", ")", ")"},
 		},
+		{
+			name:       "function call",
+			expression: "max(1, x2)+sqrt(4.5)",
+			want:       []string{"max", "(", "1", ",", "x2", ")", "+", "sqrt", "(", "4.5", ")"},
+		},
+		{
+			name:       "whitespace",
+			expression: " 2 *\t3\n",
+			want:       []string{"2", "*", "3"},
+		},
 	}
 	for _, tc := range cases {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			got := splitExpression(tc.expression)
+			got := tokenTexts(splitExpression(tc.expression))
 			if len(got) != len(tc.want) {
 				t.Errorf("splitExpression(%v) = %v; want %v", tc.expression, got, tc.want)
 				return
@@ -62,8 +93,18 @@ func TestPrecedence(t *testing.T) {
 			want: 2,
 		},
 		{
-			name: "unknown operator",
+			name: "unary minus",
+			op:   "~",
+			want: 3,
+		},
+		{
+			name: "exponentiation",
 			op:   "^",
+			want: 4,
+		},
+		{
+			name: "unknown operator",
+			op:   "&",
 			want: 0,
 		},
 	}
@@ -99,11 +140,56 @@ func TestToRPN(t *testing.T) {
 			expression: []string{"2", "+", "2", "*", "(", "3", "+", "3", "*", "(", "1", "+", "2", ")", ")"},
 			want:       []string{"2", "2", "3", "3", "1", "2", "+", "*", "+", "*", "+"},
 		},
+		{
+			name:       "unary minus",
+			expression: []string{"-", "3", "+", "2"},
+			want:       []string{"3", "~", "2", "+"},
+		},
+		{
+			name:       "unary minus in parentheses",
+			expression: []string{"2", "*", "(", "-", "1", ")"},
+			want:       []string{"2", "1", "~", "*"},
+		},
+		{
+			name:       "unary plus",
+			expression: []string{"+", "2", "*", "+", "3"},
+			want:       []string{"2", "3", "*"},
+		},
+		{
+			name:       "right associative power",
+			expression: []string{"2", "^", "3", "^", "2"},
+			want:       []string{"2", "3", "2", "^", "^"},
+		},
+		{
+			name:       "power binds tighter than unary minus",
+			expression: []string{"-", "2", "^", "2"},
+			want:       []string{"2", "2", "^", "~"},
+		},
+		{
+			name:       "modulo",
+			expression: []string{"7", "+", "5", "%", "3"},
+			want:       []string{"7", "5", "3", "%", "+"},
+		},
+		{
+			name:       "function call",
+			expression: []string{"max", "(", "1", ",", "2", "+", "3", ")", "*", "2"},
+			want:       []string{"1", "2", "3", "+", "max(2)", "2", "*"},
+		},
+		{
+			name:       "nested function calls",
+			expression: []string{"sqrt", "(", "abs", "(", "-", "16", ")", ")"},
+			want:       []string{"16", "~", "abs(1)", "sqrt(1)"},
+		},
 	}
 	for _, tc := range cases {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			got := toRPN(tc.expression)
+			rpn, err := toRPN(newTokens(tc.expression))
+			if err != nil {
+				t.Errorf("toRPN(%v) returned an error: %v", tc.expression, err)
+				return
+			}
+			got := tokenTexts(rpn)
 			if len(got) != len(tc.want) {
 				t.Errorf("toRPN(%v) = %v; want %v", tc.expression, got, tc.want)
 				return
@@ -169,6 +255,38 @@ func TestCalc2(t *testing.T) {
 		{"2+2*3+3*(1+2)+5/5", 18, false},
 		{"2+2*3+3*(1+2)+5/0", 0, true},
 		{"2+2*3+3*(1+2)+5/5-1", 17, false},
+		{"-3+2", -1, false},
+		{"2*(-1)", -2, false},
+		{"2*-1", -2, false},
+		{"--2", 2, false},
+		{"+2", 2, false},
+		{"-2^2", -4, false},
+		{"2^-1", 0.5, false},
+		{"2^3^2", 512, false},
+		{"(2^3)^2", 64, false},
+		{"2*3^2", 18, false},
+		{"7%3", 1, false},
+		{"7+5%3*2", 11, false},
+		{"7%0", 0, true},
+		{"2^", 0, true},
+		{"-", 0, true},
+		{"sqrt(16)", 4, false},
+		{"abs(-2)+1", 3, false},
+		{"2*sqrt(abs(-16))", 8, false},
+		{"sin(0)+cos(0)+tan(0)", 1, false},
+		{"ln(1)", 0, false},
+		{"log(100)", 2, false},
+		{"log(2, 8)", 3, false},
+		{"min(3, 1, 2)", 1, false},
+		{"max(3, 1+5, 2)", 6, false},
+		{"max(-1)", -1, false},
+		{"round(2.6)", 3, false},
+		{"round(2.345, 2)", 2.35, false},
+		{"min()", 0, true},
+		{"sqrt(1, 2)", 0, true},
+		{"foo(1)", 0, true},
+		{"max(1,2", 0, true},
+		{"1,2", 0, true},
 	}
 	operations := NewOperationsDefault()
 	for _, test := range tests {
@@ -255,3 +373,143 @@ func TestDefaultCalc2(t *testing.T) {
 		}
 	}
 }
+
+func TestGraph(t *testing.T) {
+	graph, err := NewOperationsDefault().Graph("(1+2)*(3+4)")
+	if err != nil {
+		t.Fatalf("Graph returned an error: %v", err)
+	}
+	want := []GraphNode{
+		{Value: 1},
+		{Value: 2},
+		{Operation: "+", Args: []int{0, 1}},
+		{Value: 3},
+		{Value: 4},
+		{Operation: "+", Args: []int{3, 4}},
+		{Operation: "*", Args: []int{2, 5}},
+	}
+	if len(graph.Nodes) != len(want) {
+		t.Fatalf("Graph returned %d nodes; want %d", len(graph.Nodes), len(want))
+	}
+	for i, node := range graph.Nodes {
+		if node.Value != want[i].Value || node.Operation != want[i].Operation || len(node.Args) != len(want[i].Args) {
+			t.Errorf("node %d = %+v; want %+v", i, node, want[i])
+			continue
+		}
+		for j := range node.Args {
+			if node.Args[j] != want[i].Args[j] {
+				t.Errorf("node %d = %+v; want %+v", i, node, want[i])
+			}
+		}
+	}
+	if graph.Root != 6 {
+		t.Errorf("Root = %d; want 6", graph.Root)
+	}
+
+	for _, expression := range []string{"", "2+", "2+2*(3+3*(1+2"} {
+		if _, err := NewOperationsDefault().Graph(expression); err == nil {
+			t.Errorf("Graph(%q) expected an error", expression)
+		}
+	}
+}
+
+func TestGraphExactRange(t *testing.T) {
+	ops := NewOperationsDefault()
+	ops.Exact = true
+	huge := strings.Repeat("9", 400)
+	graph, err := ops.Graph("-" + huge + "*2")
+	if err != nil {
+		t.Fatalf("Graph returned an error: %v", err)
+	}
+	if node := graph.Nodes[0]; node.Exact != huge || node.Value != math.MaxFloat64 {
+		t.Errorf("node 0 = %+v; want exact %s and value %v", node, huge, math.MaxFloat64)
+	}
+	if _, err := Calc(huge); err == nil {
+		t.Errorf("Calc(%q) expected an error", huge)
+	}
+}
+
+func TestCalcVariables(t *testing.T) {
+	tests := []struct {
+		expression string
+		variables  map[string]float64
+		expected   float64
+		err        string
+	}{
+		{"x*2", map[string]float64{"x": 2.5}, 5, ""},
+		{"rate*(1+x)", map[string]float64{"x": 1, "rate": 3}, 6, ""},
+		{"-x", map[string]float64{"x": 2}, -2, ""},
+		{"max(x, y)", map[string]float64{"x": 2, "y": 3}, 3, ""},
+		{"round(pi*100)", nil, 314, ""},
+		{"ln(e)", nil, 1, ""},
+		{"pi", map[string]float64{"pi": 3}, 3, ""},
+		{"x+1", nil, 0, "неизвестная переменная \"x\" в позиции 0"},
+		{"2*rate", map[string]float64{"x": 1}, 0, "неизвестная переменная \"rate\" в позиции 2"},
+	}
+	for _, test := range tests {
+		operations := NewOperationsDefault()
+		operations.Variables = test.variables
+		result, err := operations.Calc(test.expression)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Calc(%q) error = %v; want %q", test.expression, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Calc(%q) returned an error: %v", test.expression, err)
+		}
+		if result != test.expected {
+			t.Errorf("Calc(%q) = %v; want %v", test.expression, result, test.expected)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		code       string
+		offset     int
+		token      string
+	}{
+		{"", ErrCodeEmptyExpression, 0, ""},
+		{"   ", ErrCodeEmptyExpression, 0, ""},
+		{"2+", ErrCodeUnexpectedEnd, 2, ""},
+		{"2 * ", ErrCodeUnexpectedEnd, 3, ""},
+		{"2+*3", ErrCodeMissingOperand, 2, "*"},
+		{"*3", ErrCodeMissingOperand, 0, "*"},
+		{"2 3", ErrCodeUnexpectedToken, 2, "3"},
+		{"2(3)", ErrCodeUnexpectedToken, 1, "("},
+		{"(2+3", ErrCodeUnmatchedParenthesis, 0, "("},
+		{"2+3)", ErrCodeUnmatchedParenthesis, 3, ")"},
+		{"()", ErrCodeMissingOperand, 1, ")"},
+		{"(1,2)", ErrCodeUnexpectedToken, 2, ","},
+		{"max(1,)", ErrCodeMissingOperand, 6, ")"},
+		{"2&3", ErrCodeUnexpectedCharacter, 1, "&"},
+		{"2~3", ErrCodeUnexpectedCharacter, 1, "~"},
+		{"1.2.3+1", ErrCodeInvalidNumber, 0, "1.2.3"},
+		{"1+" + strings.Repeat("9", 400), ErrCodeInvalidNumber, 2, strings.Repeat("9", 400)},
+		{"1+foo(2)", ErrCodeUnknownFunction, 2, "foo"},
+		{"1+sqrt(2,3)", ErrCodeArgumentCount, 2, "sqrt"},
+		{"min()", ErrCodeArgumentCount, 0, "min"},
+		{"2*(y+1)", ErrCodeUnknownVariable, 3, "y"},
+		{"«2", ErrCodeUnexpectedCharacter, 0, "«"},
+		{"1+«2", ErrCodeUnexpectedCharacter, 2, "«"},
+		{"«»+x", ErrCodeUnexpectedCharacter, 0, "«"},
+	}
+	for _, test := range tests {
+		_, err := NewOperationsDefault().Graph(test.expression)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("Graph(%q) error = %v; want *ParseError", test.expression, err)
+			continue
+		}
+		if parseErr.Code != test.code || parseErr.Offset != test.offset || parseErr.Token != test.token {
+			t.Errorf("Graph(%q) error = %+v; want code %s, offset %d, token %q",
+				test.expression, parseErr, test.code, test.offset, test.token)
+		}
+		if parseErr.Message == "" {
+			t.Errorf("Graph(%q) error has empty message", test.expression)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package calc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDivisionByZero возвращается при попытке деления на ноль.
+var ErrDivisionByZero = errors.New("деление на ноль")
+
+// Коды ошибок разбора выражения
+const (
+	ErrCodeEmptyExpression      = "empty_expression"
+	ErrCodeUnexpectedCharacter  = "unexpected_character"
+	ErrCodeUnexpectedToken      = "unexpected_token"
+	ErrCodeUnexpectedEnd        = "unexpected_end"
+	ErrCodeMissingOperand       = "missing_operand"
+	ErrCodeUnmatchedParenthesis = "unmatched_parenthesis"
+	ErrCodeInvalidNumber        = "invalid_number"
+	ErrCodeUnknownFunction      = "unknown_function"
+	ErrCodeUnknownVariable      = "unknown_variable"
+	ErrCodeArgumentCount        = "invalid_argument_count"
+)
+
+// Коды ошибок выполнения задач, которые агент передает оркестратору вместе с
+// ErrCodeArgumentCount и ErrCodeInvalidNumber
+const (
+	ErrCodeDivisionByZero       = "division_by_zero"
+	ErrCodeUnsupportedOperation = "unsupported_operation"
+)
+
+// errorMessages содержит описания ошибок разбора для каждого кода.
+var errorMessages = map[string]string{
+	ErrCodeEmptyExpression:      "пустое выражение",
+	ErrCodeUnexpectedCharacter:  "недопустимый символ",
+	ErrCodeUnexpectedToken:      "неожиданный токен",
+	ErrCodeUnexpectedEnd:        "неожиданный конец выражения",
+	ErrCodeMissingOperand:       "пропущен операнд",
+	ErrCodeUnmatchedParenthesis: "непарная скобка",
+	ErrCodeInvalidNumber:        "некорректное число",
+	ErrCodeUnknownFunction:      "неизвестная функция",
+	ErrCodeUnknownVariable:      "неизвестная переменная",
+	ErrCodeArgumentCount:        "некорректное число аргументов функции",
+}
+
+// ParseError описывает синтаксическую ошибку в выражении.
+type ParseError struct {
+	Code    string `json:"code"`    // Код ошибки, например, unexpected_token
+	Offset  int    `json:"offset"`  // Смещение ошибочного токена в байтах от начала выражения
+	Token   string `json:"token"`   // Ошибочный токен, пустой для конца выражения
+	Message string `json:"message"` // Описание ошибки
+}
+
+// newParseError создает ошибку разбора для токена с заданным кодом.
+func newParseError(code string, tok token) *ParseError {
+	return &ParseError{
+		Code:    code,
+		Offset:  tok.pos,
+		Token:   tok.text,
+		Message: errorMessages[code],
+	}
+}
+
+// Error возвращает описание ошибки с позицией.
+// Пример: неожиданный токен ")" в позиции 3
+func (e *ParseError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("%s в позиции %d", e.Message, e.Offset)
+	}
+	return fmt.Sprintf("%s %q в позиции %d", e.Message, e.Token, e.Offset)
+}
@@ -0,0 +1,243 @@
+package calc
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Режимы вычисления выражения.
+const (
+	ModeFloat    = "float"    // Числа с плавающей точкой float64, режим по умолчанию
+	ModeDecimal  = "decimal"  // Десятичные числа произвольной точности
+	ModeRational = "rational" // Обыкновенные дроби без округления
+)
+
+// DecimalPlaces задает число знаков после запятой, до которого в режиме decimal
+// округляется результат каждой операции. Сложение, вычитание и умножение
+// при этом выполняются без потери точности.
+var DecimalPlaces = 34
+
+// maxExactExponent ограничивает показатель степени, которая вычисляется точно.
+const maxExactExponent = 10000
+
+// maxExactBits ограничивает размер числителя и знаменателя точного значения
+// в битах, около 315 тысяч десятичных знаков, чтобы вложенные степени вроде
+// ((9^9999)^9999)^9999 не исчерпали память агента.
+const maxExactBits = 1 << 20
+
+// ErrUnknownMode возвращается, если режим вычисления не поддерживается.
+var ErrUnknownMode = errors.New("неизвестный режим вычисления")
+
+// ErrNumberTooLarge возвращается, если точное значение превышает maxExactBits.
+var ErrNumberTooLarge = errors.New("слишком большое число")
+
+// ErrInvalidNumber возвращается, если точное значение не удалось разобрать
+// или результат операции не является конечным числом.
+var ErrInvalidNumber = errors.New("некорректное число")
+
+// ParseMode проверяет режим вычисления. Пустой режим означает ModeFloat.
+func ParseMode(mode string) (string, error) {
+	switch mode {
+	case "", ModeFloat:
+		return ModeFloat, nil
+	case ModeDecimal, ModeRational:
+		return mode, nil
+	}
+	return "", ErrUnknownMode
+}
+
+// IsExactMode проверяет, выполняются ли вычисления в режиме без потери точности.
+func IsExactMode(mode string) bool {
+	return mode == ModeDecimal || mode == ModeRational
+}
+
+// ParseExact разбирает точное значение из строки в десятичной записи или в виде дроби.
+// Пример: "0.1" -> 1/10, "-3" -> -3, "22/7" -> 22/7
+func ParseExact(s string) (*big.Rat, error) {
+	x, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return nil, ErrInvalidNumber
+	}
+	return x, nil
+}
+
+// ExactFromFloat преобразует float64 в точное значение по его кратчайшей
+// десятичной записи, поэтому 0.1 превращается ровно в 1/10.
+func ExactFromFloat(value float64) (*big.Rat, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, ErrInvalidNumber
+	}
+	return ParseExact(strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// FormatExact записывает точное значение в виде строки для заданного режима.
+// Пример: 3/10, decimal -> "0.3"; 3/10, rational -> "3/10"; 2/1, rational -> "2"
+func FormatExact(x *big.Rat, mode string) string {
+	if mode == ModeRational {
+		return x.RatString()
+	}
+	s := x.FloatString(DecimalPlaces)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// ExactToFloat возвращает ближайшее к точному значению конечное число float64.
+// Значения вне диапазона float64 заменяются на ±math.MaxFloat64.
+func ExactToFloat(x *big.Rat) float64 {
+	value, _ := x.Float64()
+	if math.IsInf(value, 0) {
+		return math.Copysign(math.MaxFloat64, value)
+	}
+	return value
+}
+
+// ExactOperation выполняет операцию над точными значениями, записанными строками,
+// и возвращает результат в записи режима mode. Операции +, -, *, /, %, ~,
+// целая степень и функции abs, min, max, round выполняются точно, остальные
+// функции вычисляются в float64.
+// Пример: decimal, "+", ["0.1", "0.2"] -> "0.3"; rational, "/", ["1", "3"] -> "1/3"
+func ExactOperation(mode, operation string, args []string) (string, error) {
+	values := make([]*big.Rat, len(args))
+	for i, arg := range args {
+		value, err := ParseExact(arg)
+		if err != nil {
+			return "", err
+		}
+		values[i] = value
+	}
+	result, err := exactOperation(operation, values)
+	if err != nil {
+		return "", err
+	}
+	if exactBits(result) > maxExactBits {
+		return "", ErrNumberTooLarge
+	}
+	return FormatExact(result, mode), nil
+}
+
+// exactOperation выполняет операцию над точными значениями.
+func exactOperation(operation string, args []*big.Rat) (*big.Rat, error) {
+	switch operation {
+	case "+", "-", "*", "/", "%", "^":
+		if len(args) != 2 {
+			return nil, ErrInvalidNumber
+		}
+		a, b := args[0], args[1]
+		switch operation {
+		case "+":
+			return new(big.Rat).Add(a, b), nil
+		case "-":
+			return new(big.Rat).Sub(a, b), nil
+		case "*":
+			return new(big.Rat).Mul(a, b), nil
+		case "/":
+			if b.Sign() == 0 {
+				return nil, ErrDivisionByZero
+			}
+			return new(big.Rat).Quo(a, b), nil
+		case "%":
+			if b.Sign() == 0 {
+				return nil, ErrDivisionByZero
+			}
+			// Остаток имеет знак делимого, как у math.Mod
+			q := new(big.Rat).Quo(a, b)
+			trunc := new(big.Int).Quo(q.Num(), q.Denom())
+			return new(big.Rat).Sub(a, new(big.Rat).Mul(b, new(big.Rat).SetInt(trunc))), nil
+		case "^":
+			if b.IsInt() && b.Num().IsInt64() && abs64(b.Num().Int64()) <= maxExactExponent {
+				return exactPower(a, b.Num().Int64())
+			}
+		}
+	case "~":
+		if len(args) != 1 {
+			return nil, ErrInvalidNumber
+		}
+		return new(big.Rat).Neg(args[0]), nil
+	case "abs":
+		if len(args) == 1 {
+			return new(big.Rat).Abs(args[0]), nil
+		}
+	case "min", "max":
+		if len(args) == 0 {
+			return nil, ErrInvalidNumber
+		}
+		result := args[0]
+		for _, arg := range args[1:] {
+			if (operation == "min") == (arg.Cmp(result) < 0) {
+				result = arg
+			}
+		}
+		return new(big.Rat).Set(result), nil
+	case "round":
+		if len(args) == 1 {
+			return ParseExact(args[0].FloatString(0))
+		}
+		// FloatString округляет половины от нуля, как и math.Round
+		if len(args) == 2 && args[1].IsInt() && args[1].Num().IsInt64() &&
+			args[1].Sign() >= 0 && args[1].Num().Int64() <= maxExactExponent {
+			return ParseExact(args[0].FloatString(int(args[1].Num().Int64())))
+		}
+	}
+	return floatOperation(operation, args)
+}
+
+// exactPower возводит точное значение в целую степень.
+func exactPower(a *big.Rat, exp int64) (*big.Rat, error) {
+	if exp < 0 {
+		if a.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		a = new(big.Rat).Inv(a)
+		exp = -exp
+	}
+	// Размер результата оценивается до вычисления степени
+	if int64(exactBits(a))*exp > maxExactBits {
+		return nil, ErrNumberTooLarge
+	}
+	e := big.NewInt(exp)
+	num := new(big.Int).Exp(a.Num(), e, nil)
+	denom := new(big.Int).Exp(a.Denom(), e, nil)
+	return new(big.Rat).SetFrac(num, denom), nil
+}
+
+// exactBits возвращает размер в битах большего из числителя и знаменателя.
+func exactBits(x *big.Rat) int {
+	return max(x.Num().BitLen(), x.Denom().BitLen())
+}
+
+// floatOperation вычисляет операцию в float64 для случаев, когда точный
+// результат в общем случае не выражается конечной дробью, например, sqrt(2).
+func floatOperation(operation string, args []*big.Rat) (*big.Rat, error) {
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		values[i] = ExactToFloat(arg)
+	}
+	var result float64
+	switch operation {
+	case "^":
+		result = math.Pow(values[0], values[1])
+	default:
+		function, ok := DefaultFunctions()[operation]
+		if !ok || len(values) < function.MinArgs || (function.MaxArgs >= 0 && len(values) > function.MaxArgs) {
+			return nil, ErrInvalidNumber
+		}
+		result = function.Func(values...)
+	}
+	return ExactFromFloat(result)
+}
+
+// abs64 возвращает модуль целого числа.
+func abs64(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,105 @@
+package calc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		mode string
+		want string
+		err  error
+	}{
+		{"", ModeFloat, nil},
+		{ModeFloat, ModeFloat, nil},
+		{ModeDecimal, ModeDecimal, nil},
+		{ModeRational, ModeRational, nil},
+		{"binary", "", ErrUnknownMode},
+	}
+	for _, test := range tests {
+		mode, err := ParseMode(test.mode)
+		if mode != test.want || !errors.Is(err, test.err) {
+			t.Errorf("ParseMode(%q) = %q, %v; want %q, %v", test.mode, mode, err, test.want, test.err)
+		}
+	}
+}
+
+func TestExactOperationDecimal(t *testing.T) {
+	tests := []struct {
+		operation string
+		args      []string
+		want      string
+		err       error
+	}{
+		{"+", []string{"0.1", "0.2"}, "0.3", nil},
+		{"-", []string{"0.3", "0.1"}, "0.2", nil},
+		{"*", []string{"12345678901234567890", "10"}, "123456789012345678900", nil},
+		{"/", []string{"1", "4"}, "0.25", nil},
+		{"/", []string{"2", "3"}, "0.6666666666666666666666666666666667", nil},
+		{"/", []string{"1", "0"}, "", ErrDivisionByZero},
+		{"%", []string{"-7.5", "2"}, "-1.5", nil},
+		{"%", []string{"1", "0"}, "", ErrDivisionByZero},
+		{"^", []string{"1.1", "2"}, "1.21", nil},
+		{"^", []string{"2", "-2"}, "0.25", nil},
+		{"^", []string{"0", "-1"}, "", ErrDivisionByZero},
+		{"^", []string{"4", "0.5"}, "2", nil},
+		{"~", []string{"0.1"}, "-0.1", nil},
+		{"~", []string{"0"}, "0", nil},
+		{"abs", []string{"-0.1"}, "0.1", nil},
+		{"max", []string{"0.1", "0.3", "0.2"}, "0.3", nil},
+		{"min", []string{"0.1", "-0.3", "0.2"}, "-0.3", nil},
+		{"round", []string{"2.345", "2"}, "2.35", nil},
+		{"round", []string{"-2.5"}, "-3", nil},
+		{"sqrt", []string{"16"}, "4", nil},
+		{"+", []string{"abc", "1"}, "", ErrInvalidNumber},
+		{"sqrt", []string{"-1"}, "", ErrInvalidNumber},
+		{"unknown", []string{"1"}, "", ErrInvalidNumber},
+		{"^", []string{"1" + strings.Repeat("0", 60), "9999"}, "", ErrNumberTooLarge},
+		{"^", []string{"0.1", "-9999"}, "1" + strings.Repeat("0", 9999), nil},
+		{"*", []string{strings.Repeat("9", 200000), strings.Repeat("9", 200000)}, "", ErrNumberTooLarge},
+	}
+	for _, test := range tests {
+		result, err := ExactOperation(ModeDecimal, test.operation, test.args)
+		if result != test.want || !errors.Is(err, test.err) {
+			t.Errorf("ExactOperation(%q, %v) = %q, %v; want %q, %v", test.operation, test.args, result, err, test.want, test.err)
+		}
+	}
+}
+
+func TestExactOperationRational(t *testing.T) {
+	tests := []struct {
+		operation string
+		args      []string
+		want      string
+	}{
+		{"/", []string{"1", "3"}, "1/3"},
+		{"*", []string{"1/3", "3"}, "1"},
+		{"+", []string{"0.1", "1/5"}, "3/10"},
+		{"-", []string{"22/7", "3"}, "1/7"},
+		{"%", []string{"22/7", "1"}, "1/7"},
+		{"^", []string{"2/3", "-2"}, "9/4"},
+		{"~", []string{"22/7"}, "-22/7"},
+		{"max", []string{"1/3", "0.33"}, "1/3"},
+		{"round", []string{"22/7", "2"}, "157/50"},
+	}
+	for _, test := range tests {
+		result, err := ExactOperation(ModeRational, test.operation, test.args)
+		if err != nil || result != test.want {
+			t.Errorf("ExactOperation(%q, %v) = %q, %v; want %q", test.operation, test.args, result, err, test.want)
+		}
+	}
+}
+
+func TestGraphExactValues(t *testing.T) {
+	operations := NewOperationsDefault()
+	operations.Variables = map[string]float64{"x": 0.1}
+	graph, err := operations.Graph("12345678901234567890.5+x")
+	if err != nil {
+		t.Fatalf("Graph returned an error: %v", err)
+	}
+	if graph.Nodes[0].Exact != "12345678901234567890.5" || graph.Nodes[1].Exact != "0.1" {
+		t.Errorf("unexpected exact values: %q, %q", graph.Nodes[0].Exact, graph.Nodes[1].Exact)
+	}
+}
@@ -0,0 +1,79 @@
+package calc
+
+import (
+	"math"
+)
+
+// Function описывает математическую функцию, которую можно вызвать в выражении.
+type Function struct {
+	MinArgs int                           // Минимальное число аргументов
+	MaxArgs int                           // Максимальное число аргументов, -1 — без ограничения
+	Func    func(args ...float64) float64 // Реализация функции
+}
+
+// unary создает функцию одного аргумента.
+func unary(f func(float64) float64) Function {
+	return Function{
+		MinArgs: 1,
+		MaxArgs: 1,
+		Func: func(args ...float64) float64 {
+			return f(args[0])
+		},
+	}
+}
+
+// DefaultFunctions возвращает реестр функций по умолчанию.
+// Пример: "sqrt(16)" -> 4, "log(2, 8)" -> 3, "max(1, 5, 3)" -> 5
+func DefaultFunctions() map[string]Function {
+	return map[string]Function{
+		"sqrt": unary(math.Sqrt),
+		"abs":  unary(math.Abs),
+		"sin":  unary(math.Sin),
+		"cos":  unary(math.Cos),
+		"tan":  unary(math.Tan),
+		"ln":   unary(math.Log),
+		"log": {
+			MinArgs: 1,
+			MaxArgs: 2,
+			Func: func(args ...float64) float64 {
+				if len(args) == 1 {
+					return math.Log10(args[0])
+				}
+				return math.Log(args[1]) / math.Log(args[0])
+			},
+		},
+		"min": {
+			MinArgs: 1,
+			MaxArgs: -1,
+			Func: func(args ...float64) float64 {
+				result := args[0]
+				for _, v := range args[1:] {
+					result = math.Min(result, v)
+				}
+				return result
+			},
+		},
+		"max": {
+			MinArgs: 1,
+			MaxArgs: -1,
+			Func: func(args ...float64) float64 {
+				result := args[0]
+				for _, v := range args[1:] {
+					result = math.Max(result, v)
+				}
+				return result
+			},
+		},
+		"round": {
+			MinArgs: 1,
+			MaxArgs: 2,
+			Func: func(args ...float64) float64 {
+				if len(args) == 1 {
+					return math.Round(args[0])
+				}
+				scale := math.Pow(10, math.Round(args[1]))
+				return math.Round(args[0]*scale) / scale
+			},
+		},
+	}
+}